@@ -5,15 +5,25 @@ import (
 	"gcoin/util"
 )
 
+// IndexValidated is implemented by block data that commits to its own index
+type IndexValidated interface {
+	ValidateIndex(index uint64) error
+}
+
+// LimitValidated is implemented by block data with consensus resource limits
+type LimitValidated interface {
+	ValidateLimits() error
+}
+
 type Block[T util.Hashable] struct {
 	BlockHash   util.Hash
 	BlockHeader BlockHeader
 	Data        T
 }
 
-func NewBlock[T util.Hashable](data T) Block[T] {
+func NewBlock[T util.Hashable](data T, clock util.Clock) Block[T] {
 	innerHash := data.Hash()
-	blockHeader := NewBlockHeader(innerHash)
+	blockHeader := NewBlockHeader(innerHash, clock)
 	return Block[T]{
 		BlockHash:   blockHeader.Hash(),
 		BlockHeader: blockHeader,
@@ -24,8 +34,8 @@ func (b *Block[T]) Mine() {
 	b.BlockHash = b.BlockHeader.Mine()
 }
 
-func (b *Block[T]) Validate() error {
-	if err := b.BlockHeader.Validate(); err != nil {
+func (b *Block[T]) Validate(clock util.Clock) error {
+	if err := b.BlockHeader.Validate(clock); err != nil {
 		return err
 	}
 	if b.BlockHeader.InnerHash != b.Data.Hash() {
@@ -34,6 +44,11 @@ func (b *Block[T]) Validate() error {
 	if b.BlockHeader.Hash() != b.BlockHash {
 		return fmt.Errorf("hash mismatch")
 	}
+	if data, ok := any(b.Data).(IndexValidated); ok {
+		if err := data.ValidateIndex(b.BlockHeader.Index); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
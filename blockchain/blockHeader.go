@@ -3,7 +3,6 @@ package blockchain
 import (
 	"fmt"
 	"gcoin/util"
-	"time"
 )
 
 type BlockHeader struct {
@@ -16,7 +15,7 @@ type BlockHeader struct {
 	Timestamp int64     // When is the block created
 }
 
-func NewBlockHeader(innerHash util.Hash) BlockHeader {
+func NewBlockHeader(innerHash util.Hash, clock util.Clock) BlockHeader {
 	return BlockHeader{
 		Diff:      1,
 		Index:     0,
@@ -24,11 +23,12 @@ func NewBlockHeader(innerHash util.Hash) BlockHeader {
 		Nonce:     0,
 		PrevHash:  util.Hash{},
 		Target:    0,
-		Timestamp: time.Now().UnixMilli()}
+		Timestamp: clock.Now()}
 }
 
+// Hash is over the fields in order
 func (bh *BlockHeader) Hash() util.Hash {
-	return util.NewHash(bh)
+	return util.NewBinaryHash(bh)
 }
 
 func (bh *BlockHeader) Mine() util.Hash {
@@ -46,8 +46,8 @@ func (bh *BlockHeader) isGenesisBlockHeader() bool {
 	return bh.Index == 0 && bh.Diff == 1 && bh.Nonce == 0 && bh.PrevHash == util.Hash{} && bh.Target == 0
 }
 
-func (bh *BlockHeader) Validate() error {
-	if bh.Timestamp-NUM_MILLISECONDS_TIME_DIFF_TOLERANCE >= time.Now().UnixMilli() {
+func (bh *BlockHeader) Validate(clock util.Clock) error {
+	if bh.Timestamp-NUM_MILLISECONDS_TIME_DIFF_TOLERANCE >= clock.Now() {
 		return fmt.Errorf("is from far future")
 	}
 	return nil
@@ -4,22 +4,21 @@ import (
 	"fmt"
 	"gcoin/util"
 	"slices"
-	"time"
 )
 
 type Chain[T util.Hashable] []Block[T]
 
-func NewChain[T util.Hashable](s []T) Chain[T] {
+func NewChain[T util.Hashable](s []T, clock util.Clock) Chain[T] {
 	var chain Chain[T]
 	for _, data := range s {
-		b := chain.NextUnmintedBlock(data)
+		b := chain.NextUnmintedBlock(data, clock)
 		b.Mine()
 		chain = append(chain, b)
 	}
 	return chain
 }
 
-func RebuildChain[T util.Hashable](m map[util.Hash]Block[T], cur Block[T]) (Chain[T], error) {
+func RebuildChain[T util.Hashable](m map[util.Hash]Block[T], cur Block[T], clock util.Clock) (Chain[T], error) {
 	var chain Chain[T]
 	for {
 		chain = append(chain, cur)
@@ -33,7 +32,7 @@ func RebuildChain[T util.Hashable](m map[util.Hash]Block[T], cur Block[T]) (Chai
 		cur = prev
 	}
 	slices.Reverse(chain)
-	if err := chain.Validate(); err != nil {
+	if err := chain.Validate(clock); err != nil {
 		return nil, err
 	}
 	return chain, nil
@@ -64,10 +63,10 @@ func (chain Chain[T]) ComputeTarget(bh *BlockHeader) uint8 {
 	}
 }
 
-func (chain Chain[T]) NextUnmintedBlock(data T) Block[T] {
+func (chain Chain[T]) NextUnmintedBlock(data T, clock util.Clock) Block[T] {
 	last := util.Last(chain)
 	if last == nil {
-		return NewBlock(data)
+		return NewBlock(data, clock)
 	}
 	bh := &last.BlockHeader
 	index := bh.Index + 1
@@ -76,7 +75,7 @@ func (chain Chain[T]) NextUnmintedBlock(data T) Block[T] {
 		InnerHash: data.Hash(),
 		Nonce:     0,
 		PrevHash:  bh.Hash(),
-		Timestamp: time.Now().UnixMilli()}
+		Timestamp: clock.Now()}
 	blockHeader.Target = chain.ComputeTarget(&blockHeader)
 	blockHeader.Diff = bh.Diff + (1 << blockHeader.Target)
 	return Block[T]{
@@ -85,17 +84,22 @@ func (chain Chain[T]) NextUnmintedBlock(data T) Block[T] {
 		Data:        data}
 }
 
-func (chain Chain[T]) ValidateNextBlock(b *Block[T]) error {
+func (chain Chain[T]) ValidateNextBlock(b *Block[T], clock util.Clock) error {
 	if b.BlockHeader.Index != uint64(len(chain)) {
 		return fmt.Errorf("index != len")
 	}
-	return chain.ValidateBlock(b)
+	return chain.ValidateBlock(b, clock)
 }
 
-func (chain Chain[T]) ValidateBlock(b *Block[T]) error {
-	if err := b.Validate(); err != nil {
+func (chain Chain[T]) ValidateBlock(b *Block[T], clock util.Clock) error {
+	if err := b.Validate(clock); err != nil {
 		return err
 	}
+	if data, ok := any(b.Data).(LimitValidated); ok {
+		if err := data.ValidateLimits(); err != nil {
+			return err
+		}
+	}
 	bh := &b.BlockHeader
 
 	switch index := bh.Index; {
@@ -117,15 +121,38 @@ func (chain Chain[T]) ValidateBlock(b *Block[T]) error {
 	return nil
 }
 
-func (chain Chain[T]) Validate() error {
+func (chain Chain[T]) Validate(clock util.Clock) error {
 	for i := range chain {
-		if err := chain.ValidateBlock(&chain[i]); err != nil {
+		if err := chain.ValidateBlock(&chain[i], clock); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// ForkIndex is the index of the first block where chain and other differ
+func (chain Chain[T]) ForkIndex(other Chain[T]) int {
+	n := min(len(chain), len(other))
+	for i := range n {
+		if chain[i].BlockHash != other[i].BlockHash {
+			return i
+		}
+	}
+	return n
+}
+
+// CommonPrefix is the number of blocks at the start of every chain, 0 without chains
+func CommonPrefix[T util.Hashable](chains ...Chain[T]) int {
+	if len(chains) == 0 {
+		return 0
+	}
+	prefix := chains[0]
+	for _, chain := range chains[1:] {
+		prefix = prefix[:prefix.ForkIndex(chain)]
+	}
+	return len(prefix)
+}
+
 func (chain Chain[T]) Difficulty() uint64 {
 	last := util.Last(chain)
 	if last == nil {
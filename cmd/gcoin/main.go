@@ -0,0 +1,190 @@
+// gcoin runs simulations of a gcoin network:
+//
+//	gcoin sim run [flags] scenario.json
+//
+// prints the sim.Result of the scenario as JSON, and optionally writes
+// its sim.Report as JSON, its time series as CSV and the propagation tree
+// of every block and transaction as JSON lines. With -assert, it
+// exits with status 1 unless the chains of the nodes converged. With
+// -trace, it records the messages delivered to the nodes, which
+//
+//	gcoin sim replay -node i scenario.json trace.jsonl
+//
+// feeds into a fresh node i, printing the outcome of each message.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"gcoin/explorer"
+	"gcoin/rpc"
+	"gcoin/sim"
+	"gcoin/util"
+)
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "usage: gcoin sim run [flags] scenario.json")
+	fmt.Fprintln(os.Stderr, "       gcoin sim replay [flags] scenario.json trace.jsonl")
+	if fs != nil {
+		fs.PrintDefaults()
+	}
+	os.Exit(2)
+}
+
+// fail exits with status 1 if err is not nil
+func fail(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// serve starts handler(node i) at port+i unless port is 0. The handlers
+// only read the nodes under their locks, so they run alongside the simulation.
+func serve(nodes []*sim.Node, port int, handler func(node *sim.Node) http.Handler) {
+	if port == 0 {
+		return
+	}
+	for i, node := range nodes {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port+i))
+		fail(err)
+		go func() { fail(http.Serve(listener, handler(node))) }()
+	}
+}
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "sim" {
+		usage(nil)
+	}
+	switch os.Args[2] {
+	case "run":
+		run(os.Args[3:])
+	case "replay":
+		replay(os.Args[3:])
+	default:
+		usage(nil)
+	}
+}
+
+func run(args []string) {
+	fs := flag.NewFlagSet("sim run", flag.ExitOnError)
+	rpcPort := fs.Int("rpc", 0, "Serve the JSON-RPC of node i at port rpc+i, 0 to disable")
+	explorerPort := fs.Int("explorer", 0, "Serve the block explorer of node i at port explorer+i, 0 to disable")
+	metricsPort := fs.Int("metrics", 0, "Serve the /metrics of node i at port metrics+i, 0 to disable")
+	eventsPort := fs.Int("events", 0, "Stream the /events of node i at port events+i, 0 to disable")
+	realtime := fs.Bool("realtime", false, "Pace virtual time to the wall clock, to watch the nodes while serving them")
+	reportPath := fs.String("report", "", "Write the metrics report as JSON to this file")
+	seriesPath := fs.String("series", "", "Write the time series of the report as CSV to this file")
+	assert := fs.Bool("assert", false, "Exit with status 1 unless the chains of the nodes converged")
+	tracePath := fs.String("trace", "", "Record the messages delivered to the nodes as JSON lines to this file")
+	propagationPath := fs.String("propagation", "", "Write the propagation tree of every block and transaction as JSON lines to this file")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage(fs)
+	}
+
+	scenario, err := sim.LoadScenario(fs.Arg(0))
+	fail(err)
+	s, err := sim.NewSimulation(scenario)
+	fail(err)
+	s.Scheduler.Realtime = *realtime
+
+	var trace *bufio.Writer
+	var tracer *sim.Tracer
+	if *tracePath != "" {
+		file, err := os.Create(*tracePath)
+		fail(err)
+		defer file.Close()
+		trace = bufio.NewWriter(file)
+		tracer = s.Record(trace)
+	}
+
+	serve(s.Nodes, *rpcPort, func(node *sim.Node) http.Handler {
+		server := rpc.NewServer()
+		node.RegisterRPC(server)
+		return server
+	})
+	serve(s.Nodes, *metricsPort, func(node *sim.Node) http.Handler {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", node.Metrics())
+		return mux
+	})
+	serve(s.Nodes, *eventsPort, func(node *sim.Node) http.Handler {
+		mux := http.NewServeMux()
+		mux.Handle("GET /events", node.Bus())
+		return mux
+	})
+	serve(s.Nodes, *explorerPort, func(node *sim.Node) http.Handler {
+		return explorer.NewExplorer(node)
+	})
+
+	result := s.Run()
+	if tracer != nil {
+		fail(tracer.Err())
+		fail(trace.Flush())
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(result); err != nil {
+		panic(err)
+	}
+	write(*reportPath, result.Report.WriteJSON)
+	write(*seriesPath, result.Report.WriteCSV)
+	write(*propagationPath, s.WritePropagation)
+	if *assert && !result.Convergence.Pass {
+		fmt.Fprintln(os.Stderr, "not converged:", result.Convergence.Reason)
+		os.Exit(1)
+	}
+}
+
+// write creates path with f unless path is empty
+func write(path string, f func(w io.Writer) error) {
+	if path == "" {
+		return
+	}
+	file, err := os.Create(path)
+	if err == nil {
+		err = f(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	fail(err)
+}
+
+func replay(args []string) {
+	fs := flag.NewFlagSet("sim replay", flag.ExitOnError)
+	id := fs.Int("node", 0, "Node to replay the messages delivered to")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		usage(fs)
+	}
+
+	scenario, err := sim.LoadScenario(fs.Arg(0))
+	fail(err)
+	file, err := os.Open(fs.Arg(1))
+	fail(err)
+	records, err := sim.ReadTrace(bufio.NewReader(file))
+	file.Close()
+	fail(err)
+
+	node, err := sim.Replay(scenario, records, *id, func(record sim.TraceRecord, err error) {
+		outcome := "ok"
+		if err != nil {
+			outcome = err.Error()
+		}
+		fmt.Printf("%v\t%s\t%d -> %d\t%s\n", time.Duration(record.Time), record.Kind, record.From, record.To, outcome)
+	})
+	fail(err)
+	if last := util.Last(node.Chain()); last != nil {
+		fmt.Printf("tip %d %v\n", last.BlockHeader.Index, last.BlockHash)
+	}
+}
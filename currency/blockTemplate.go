@@ -0,0 +1,126 @@
+package currency
+
+import (
+	"gcoin/util"
+	"slices"
+)
+
+// BlockTemplate is a set of mempool transactions selected for the next block
+type BlockTemplate struct {
+	Height uint64
+	CTxn   CoinbaseTransaction
+	RTxns  []RegularTransaction // In an order that can be connected
+	Fees   uint64
+	Size   int
+}
+
+func (tmpl *BlockTemplate) BlockTransactions() BlockTransactions {
+	return BlockTransactions{Height: tmpl.Height, CTxn: tmpl.CTxn, RTxns: tmpl.RTxns}
+}
+
+// templateEntry is a mempool transaction with its in-mempool parents
+type templateEntry struct {
+	txn     RegularTransaction
+	parents []TxId
+}
+
+// NewBlockTemplate selects transactions from mempool for the next block on view.
+// Transactions are picked by the fee rate of their ancestor packages, so that a child
+// with a high fee pulls in its parents, until the block reaches maxSize bytes.
+// The consensus limits in ActiveParams are never exceeded.
+func NewBlockTemplate(view UtxoView, mempool []RegularTransaction, address Address, maxSize int, clock util.Clock) BlockTemplate {
+	maxSize = min(maxSize, ActiveParams.MaxBlockSize)
+	maxSigOps := ActiveParams.MaxBlockSigOps
+	height := view.Height()
+	overlay := NewUtxoOverlay(view)
+	tmpl := BlockTemplate{Height: height}
+	tmpl.CTxn = NewCoinbaseTransaction(address, 0, clock)
+	tmpl.Size = tmpl.BlockTransactions().Size()
+
+	entries := make(map[TxId]*templateEntry)
+	var order []TxId // Arrival order breaks ties
+	for _, txn := range mempool {
+		if _, ok := entries[txn.TxId]; ok {
+			continue
+		}
+		entries[txn.TxId] = &templateEntry{txn: txn}
+		order = append(order, txn.TxId)
+	}
+	for _, entry := range entries {
+		for _, txIn := range entry.txn.TxData.TxIns {
+			if _, ok := entries[txIn.TxId]; ok && !slices.Contains(entry.parents, txIn.TxId) {
+				entry.parents = append(entry.parents, txIn.TxId)
+			}
+		}
+	}
+
+	// ancestors lists the unselected ancestors of txId, parents first
+	var ancestors func(txId TxId, seen map[TxId]struct{}) []TxId
+	ancestors = func(txId TxId, seen map[TxId]struct{}) []TxId {
+		if _, ok := seen[txId]; ok {
+			return nil
+		}
+		seen[txId] = struct{}{}
+		var pkg []TxId
+		for _, parent := range entries[txId].parents {
+			if _, ok := entries[parent]; ok {
+				pkg = append(pkg, ancestors(parent, seen)...)
+			}
+		}
+		return append(pkg, txId)
+	}
+
+	for len(entries) > 0 {
+		var best []TxId
+		var bestFee uint64
+		var bestSize int
+		for _, txId := range order {
+			if _, ok := entries[txId]; !ok {
+				continue
+			}
+			pkg := ancestors(txId, make(map[TxId]struct{}))
+			var fee uint64
+			var size int
+			for _, id := range pkg {
+				fee += entries[id].txn.TransactionFee
+				size += entries[id].txn.Size()
+			}
+			if best == nil || FeeRate(fee, size) > FeeRate(bestFee, bestSize) {
+				best, bestFee, bestSize = pkg, fee, size
+			}
+		}
+
+		// The package is dropped if it does not fit or does not connect,
+		// which also drops its descendants as they cannot be selected
+		tip := best[len(best)-1]
+		if tmpl.Size+bestSize > maxSize || len(tmpl.RTxns)+len(best) > maxSigOps {
+			delete(entries, tip)
+			continue
+		}
+		staged := NewUtxoOverlay(overlay)
+		var applied []RegularTransaction
+		for _, txId := range best {
+			txn := entries[txId].txn
+			if err := ValidateRegularTransaction(staged, &txn); err != nil {
+				delete(entries, txId)
+				break
+			}
+			staged.UpdateTxData(txn.TxId, &txn.TxData)
+			applied = append(applied, txn)
+		}
+		if len(applied) != len(best) {
+			delete(entries, tip)
+			continue
+		}
+		staged.Commit()
+		for _, txn := range applied {
+			delete(entries, txn.TxId)
+			tmpl.RTxns = append(tmpl.RTxns, txn)
+			tmpl.Fees += txn.TransactionFee
+			tmpl.Size += txn.Size()
+		}
+	}
+
+	tmpl.CTxn = NewCoinbaseTransaction(address, Subsidy(height)+tmpl.Fees, clock)
+	return tmpl
+}
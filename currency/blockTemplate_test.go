@@ -0,0 +1,48 @@
+package currency
+
+import (
+	"gcoin/util"
+	"testing"
+)
+
+func TestNewBlockTemplate(t *testing.T) {
+	wallet1 := NewWallet()
+	wallet2 := NewWallet()
+
+	chain, _ := newMaturedChain(wallet1.GetAddress())
+	utxoDb := NewUtxoDbFromChain(chain)
+
+	parent, err := wallet1.MakeRegularTransaction(&utxoDb, wallet2.GetAddress(), 10, 0, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txData := TxData{
+		TxIns:  []TxIn{{OutPoint: OutPoint{TxId: parent.TxId, OutIdx: 0}}},
+		TxOuts: []TxOut{{Address: wallet1.GetAddress(), Amount: 5}}}
+	child := wallet2.SignTxData(txData, 5)
+
+	// The child arrives first and pays for its parent
+	tmpl := NewBlockTemplate(&utxoDb, []RegularTransaction{child, *parent}, wallet1.GetAddress(), 1<<16, util.SystemClock{})
+	if len(tmpl.RTxns) != 2 || tmpl.RTxns[0].TxId != parent.TxId || tmpl.RTxns[1].TxId != child.TxId {
+		t.Fatalf("unexpected selection %v", tmpl.RTxns)
+	}
+	if tmpl.Fees != 5 || tmpl.CTxn.Amount() != Subsidy(tmpl.Height)+5 {
+		t.Errorf("fees %d", tmpl.Fees)
+	}
+	bt := tmpl.BlockTransactions()
+	if tmpl.Size != bt.Size() {
+		t.Errorf("size %d != %d", tmpl.Size, bt.Size())
+	}
+	b := chain.NextUnmintedBlock(bt, util.SystemClock{})
+	if err := utxoDb.ConnectBlock(&b); err != nil {
+		t.Error(err)
+	}
+
+	// Only the parent fits
+	utxoDb = NewUtxoDbFromChain(chain)
+	maxSize := tmpl.Size - child.Size()
+	tmpl = NewBlockTemplate(&utxoDb, []RegularTransaction{child, *parent}, wallet1.GetAddress(), maxSize, util.SystemClock{})
+	if len(tmpl.RTxns) != 1 || tmpl.RTxns[0].TxId != parent.TxId {
+		t.Errorf("unexpected selection %v", tmpl.RTxns)
+	}
+}
@@ -1,16 +1,14 @@
 package currency
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/binary"
 	"fmt"
 	"gcoin/util"
 )
 
 type BlockTransactions struct {
-	CTxn  CoinbaseTransaction
-	RTxns []RegularTransaction
+	Height uint64 // Index of the block in the chain
+	CTxn   CoinbaseTransaction
+	RTxns  []RegularTransaction
 }
 
 func transactionFees(txns []RegularTransaction) uint64 {
@@ -21,9 +19,9 @@ func transactionFees(txns []RegularTransaction) uint64 {
 	return fees
 }
 
-func NewBlockTransactions(txns []RegularTransaction, address Address) BlockTransactions {
+func NewBlockTransactions(txns []RegularTransaction, address Address, height uint64, clock util.Clock) BlockTransactions {
 	fees := transactionFees(txns)
-	return BlockTransactions{CTxn: NewCoinbaseTransaction(address, DEFAULT_COINBASE_AMOUNT+fees), RTxns: txns}
+	return BlockTransactions{Height: height, CTxn: NewCoinbaseTransaction(address, Subsidy(height)+fees, clock), RTxns: txns}
 }
 
 func (bt BlockTransactions) Validate() error {
@@ -35,17 +33,47 @@ func (bt BlockTransactions) Validate() error {
 			return fmt.Errorf("%d: %w", i, err)
 		}
 	}
-	if bt.CTxn.Amount() != DEFAULT_COINBASE_AMOUNT+transactionFees(bt.RTxns) {
+	if bt.CTxn.Amount() != Subsidy(bt.Height)+transactionFees(bt.RTxns) {
 		return fmt.Errorf("reward mismatch")
 	}
 	return nil
 }
 
-func (bt BlockTransactions) Hash() util.Hash {
-	var buf bytes.Buffer
-	binary.Write(&buf, binary.BigEndian, bt.CTxn.TxId)
+func (bt BlockTransactions) ValidateIndex(index uint64) error {
+	if bt.Height != index {
+		return fmt.Errorf("height %d != index %d", bt.Height, index)
+	}
+	return nil
+}
+
+// Size is the number of bytes bt takes up when serialized
+func (bt BlockTransactions) Size() int {
+	size := 16 + bt.CTxn.Size()
 	for _, txn := range bt.RTxns {
-		binary.Write(&buf, binary.BigEndian, txn.TxId)
+		size += txn.Size()
+	}
+	return size
+}
+
+// SigOps is the number of signatures checked to validate bt
+func (bt BlockTransactions) SigOps() int {
+	return len(bt.RTxns)
+}
+
+func (bt BlockTransactions) ValidateLimits() error {
+	if size := bt.Size(); size > ActiveParams.MaxBlockSize {
+		return fmt.Errorf("size %d exceeds %d", size, ActiveParams.MaxBlockSize)
+	}
+	if sigOps := bt.SigOps(); sigOps > ActiveParams.MaxBlockSigOps {
+		return fmt.Errorf("sigOps %d exceeds %d", sigOps, ActiveParams.MaxBlockSigOps)
+	}
+	return nil
+}
+
+func (bt BlockTransactions) Hash() util.Hash {
+	txIds := make([]TxId, len(bt.RTxns))
+	for i, txn := range bt.RTxns {
+		txIds[i] = txn.TxId
 	}
-	return sha256.Sum256(buf.Bytes())
+	return util.NewBinaryHash(bt.Height, bt.CTxn.TxId, txIds)
 }
@@ -0,0 +1,79 @@
+package currency
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// Encoded messages may exceed the consensus size by the gob framing
+const MAX_MESSAGE_OVERHEAD = 4096
+
+type witnessMessage struct {
+	Sig []byte
+	Pub []byte
+}
+
+func (witness Witness) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(witnessMessage{Sig: witness.sig, Pub: witness.pub})
+	return buf.Bytes(), err
+}
+
+func (witness *Witness) GobDecode(data []byte) error {
+	var msg witnessMessage
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&msg); err != nil {
+		return err
+	}
+	witness.sig = msg.Sig
+	witness.pub = msg.Pub
+	return nil
+}
+
+func encode[T any](data T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode[T any](data []byte, maxSize int) (T, error) {
+	var v T
+	if len(data) > maxSize+MAX_MESSAGE_OVERHEAD {
+		return v, fmt.Errorf("message of %d bytes too large", len(data))
+	}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+func EncodeBlock(b *Block) ([]byte, error) {
+	return encode(b)
+}
+
+// DecodeBlock rejects blocks beyond the consensus limits before validating them
+func DecodeBlock(data []byte) (Block, error) {
+	b, err := decode[Block](data, ActiveParams.MaxBlockSize)
+	if err != nil {
+		return b, err
+	}
+	if err := b.Data.ValidateLimits(); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+func EncodeRegularTransaction(txn *RegularTransaction) ([]byte, error) {
+	return encode(txn)
+}
+
+func DecodeRegularTransaction(data []byte) (RegularTransaction, error) {
+	txn, err := decode[RegularTransaction](data, ActiveParams.MaxBlockSize)
+	if err != nil {
+		return txn, err
+	}
+	if size := txn.Size(); size > ActiveParams.MaxBlockSize {
+		return txn, fmt.Errorf("size %d exceeds %d", size, ActiveParams.MaxBlockSize)
+	}
+	return txn, nil
+}
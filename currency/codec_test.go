@@ -0,0 +1,61 @@
+package currency
+
+import (
+	"gcoin/blockchain"
+	"gcoin/util"
+	"testing"
+)
+
+// The hashes are consensus, so changing how they are encoded forks the chain
+func TestHashEncoding(t *testing.T) {
+	txData := TxData{
+		TxIns:     []TxIn{{OutPoint: OutPoint{TxId: TxId{1}, OutIdx: 2}, Sequence: 3}},
+		TxOuts:    []TxOut{{Address: Address{4}, Amount: 5}},
+		LockTime:  6,
+		Timestamp: 7}
+	if h := txData.Hash().String(); h != "234253cb9a8e9e3422d1935a181785a5b53926f75914a1dafbb2741b7198939c" {
+		t.Errorf("TxData hash %s", h)
+	}
+	bh := blockchain.BlockHeader{Diff: 1, Index: 2, InnerHash: txData.Hash(), Nonce: 3, PrevHash: util.Hash{4}, Target: 5, Timestamp: 6}
+	if h := bh.Hash().String(); h != "cb46eb7cf20e4ddf5e105cee4efc6bae31f3ea4d5dd9e06b5cb82b4b95e2b075" {
+		t.Errorf("BlockHeader hash %s", h)
+	}
+}
+
+func TestDecodeBlock(t *testing.T) {
+	wallet := NewWallet()
+	chain, _ := newMaturedChain(wallet.GetAddress())
+	utxoDb := NewUtxoDbFromChain(chain)
+
+	rt, err := wallet.MakeRegularTransaction(&utxoDb, wallet.GetAddress(), 1, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := chain.NextUnmintedBlock(NewBlockTransactions([]RegularTransaction{*rt}, wallet.GetAddress(), utxoDb.Height(), util.SystemClock{}), util.SystemClock{})
+	data, err := EncodeBlock(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Data.RTxns[0].Validate(); err != nil {
+		t.Error(err)
+	}
+
+	params := ActiveParams
+	defer func() { ActiveParams = params }()
+	ActiveParams.MaxBlockSigOps = 0
+	if _, err := DecodeBlock(data); err == nil {
+		t.Error("sigOps limit ignored")
+	}
+	if err := append(chain, b).Validate(util.SystemClock{}); err == nil {
+		t.Error("sigOps limit ignored")
+	}
+	ActiveParams.MaxBlockSigOps = params.MaxBlockSigOps
+	ActiveParams.MaxBlockSize = b.Data.Size() - 1
+	if err := append(chain, b).Validate(util.SystemClock{}); err == nil {
+		t.Error("size limit ignored")
+	}
+}
@@ -2,7 +2,7 @@ package currency
 
 import (
 	"fmt"
-	"time"
+	"gcoin/util"
 )
 
 type CoinbaseTransaction struct {
@@ -15,17 +15,28 @@ func (txn *CoinbaseTransaction) Validate() error {
 	if txn.TxId != txId {
 		return fmt.Errorf("txId mismatch: %s != %s", txn.TxId, txId)
 	}
+	if n := len(txn.TxData.TxIns); n != 0 {
+		return fmt.Errorf("%d txIns", n)
+	}
+	if n := len(txn.TxData.TxOuts); n != 1 {
+		return fmt.Errorf("%d txOuts", n)
+	}
 	return nil
 }
 
+// Assume txn.Validate() == nil
 func (txn *CoinbaseTransaction) Amount() uint64 {
 	return txn.TxData.TxOuts[0].Amount
 }
 
-func NewCoinbaseTransaction(address Address, amount uint64) CoinbaseTransaction {
+func (txn *CoinbaseTransaction) Size() int {
+	return 32 + txn.TxData.Size()
+}
+
+func NewCoinbaseTransaction(address Address, amount uint64, clock util.Clock) CoinbaseTransaction {
 	txData := TxData{
 		TxOuts:    []TxOut{{address, amount}},
-		Timestamp: time.Now().UnixMilli(),
+		Timestamp: clock.Now(),
 	}
 	return CoinbaseTransaction{
 		TxId:   txData.Hash(),
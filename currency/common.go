@@ -9,6 +9,9 @@ import (
 )
 
 const DEFAULT_COINBASE_AMOUNT = 50
+const LOCKTIME_THRESHOLD = 500_000_000 // Below are heights, above are unix milliseconds
+const MEDIAN_TIME_SPAN = 11            // Number of blocks the median time past is taken over
+const FEE_RATE_SCALE = 1000            // Fee rates are per FEE_RATE_SCALE bytes
 
 func Unmarshal(pub []byte) ecdsa.PublicKey {
 	Curve := elliptic.P256()
@@ -28,19 +31,47 @@ type TxOut struct {
 	Amount  uint64
 }
 
-type TxIn struct {
+type OutPoint struct {
 	TxId   TxId
 	OutIdx uint64
 }
 
+type TxIn struct {
+	OutPoint
+	Sequence uint64 // Blocks to wait after OutPoint is confirmed, 0 if none
+}
+
 type TxData struct {
 	TxIns     []TxIn
 	TxOuts    []TxOut
+	LockTime  uint64 // Height if < LOCKTIME_THRESHOLD else unix milliseconds, 0 if none
 	Timestamp int64
 }
 
+// Hash is over the fields in order, each slice after its length
 func (txData *TxData) Hash() util.Hash {
-	return util.NewHash(txData)
+	return util.NewBinaryHash(
+		uint64(len(txData.TxIns)), txData.TxIns,
+		uint64(len(txData.TxOuts)), txData.TxOuts,
+		txData.LockTime, txData.Timestamp)
+}
+
+// Size is the number of bytes txData takes up when serialized
+func (txData *TxData) Size() int {
+	return 32 + 48*len(txData.TxIns) + 40*len(txData.TxOuts)
+}
+
+// IsFinal reports whether txData can be included in a block
+// at the given height whose median time past is medianTime
+func (txData *TxData) IsFinal(height uint64, medianTime int64) bool {
+	switch lockTime := txData.LockTime; {
+	case lockTime == 0:
+		return true
+	case lockTime < LOCKTIME_THRESHOLD:
+		return height >= lockTime
+	default:
+		return medianTime >= int64(lockTime)
+	}
 }
 
 type Witness struct {
@@ -48,9 +79,31 @@ type Witness struct {
 	pub []byte
 }
 
+func (witness *Witness) Size() int {
+	return 16 + len(witness.sig) + len(witness.pub)
+}
+
+func (witness *Witness) GetSig() []byte {
+	return witness.sig
+}
+
+func (witness *Witness) GetPub() []byte {
+	return witness.pub
+}
+
 func (witness *Witness) GetAddress() Address {
 	return sha256.Sum256(witness.pub)
 }
 
 type Block = blockchain.Block[BlockTransactions]
 type Chain = blockchain.Chain[BlockTransactions]
+
+// TxLookup finds unconfirmed transactions by TxId
+type TxLookup interface {
+	Transaction(txId TxId) (*RegularTransaction, bool)
+}
+
+// FeeEstimator suggests the fee rate to confirm within target blocks
+type FeeEstimator interface {
+	EstimateFeeRate(target uint64) (uint64, error)
+}
@@ -0,0 +1,51 @@
+package currency
+
+import "fmt"
+
+// Params are the consensus rules shared by every node of a network
+type Params struct {
+	CoinbaseMaturity uint64 // Blocks to wait before a coinbase output can be spent
+	InitialSubsidy   uint64 // Block subsidy before the first halving
+	HalvingInterval  uint64 // Blocks between two halvings of the subsidy
+	TailEmission     uint64 // Subsidy never drops below this, 0 for a capped supply
+	MaxBlockSize     int    // Max serialized bytes of BlockTransactions
+	MaxBlockSigOps   int    // Max signature checks to validate BlockTransactions
+}
+
+var DefaultParams = Params{
+	CoinbaseMaturity: 10,
+	InitialSubsidy:   DEFAULT_COINBASE_AMOUNT,
+	HalvingInterval:  100,
+	TailEmission:     0,
+	MaxBlockSize:     1 << 14,
+	MaxBlockSigOps:   64,
+}
+
+func (params *Params) Validate() error {
+	if params.HalvingInterval == 0 {
+		return fmt.Errorf("halving interval is 0")
+	}
+	if params.MaxBlockSize <= 0 || params.MaxBlockSigOps < 0 {
+		return fmt.Errorf("max block size %d or sig ops %d invalid", params.MaxBlockSize, params.MaxBlockSigOps)
+	}
+	return nil
+}
+
+// ActiveParams is what the consensus checks in this package read.
+// Set it with SetActiveParams before any node starts.
+var ActiveParams = DefaultParams
+
+// SetActiveParams replaces ActiveParams, unless params are invalid
+func SetActiveParams(params Params) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	ActiveParams = params
+	return nil
+}
+
+func init() {
+	if err := ActiveParams.Validate(); err != nil {
+		panic(err)
+	}
+}
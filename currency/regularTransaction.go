@@ -25,3 +25,22 @@ func (txn *RegularTransaction) Validate() error {
 
 	return nil
 }
+
+// Size is the number of bytes txn takes up in a block
+func (txn *RegularTransaction) Size() int {
+	return 40 + txn.TxData.Size() + txn.Witness.Size()
+}
+
+// FeeRate is the fee paid per byte, scaled by FEE_RATE_SCALE
+func (txn *RegularTransaction) FeeRate() uint64 {
+	return FeeRate(txn.TransactionFee, txn.Size())
+}
+
+func FeeRate(fee uint64, size int) uint64 {
+	return fee * FEE_RATE_SCALE / uint64(size)
+}
+
+// Fee is the smallest fee paying at least feeRate for size bytes
+func Fee(feeRate uint64, size int) uint64 {
+	return (feeRate*uint64(size) + FEE_RATE_SCALE - 1) / FEE_RATE_SCALE
+}
@@ -0,0 +1,82 @@
+package currency
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// bits2int is the leftmost qlen bits of b as in RFC 6979 2.3.2
+func bits2int(b []byte, qlen int) *big.Int {
+	x := new(big.Int).SetBytes(b)
+	if excess := len(b)*8 - qlen; excess > 0 {
+		x.Rsh(x, uint(excess))
+	}
+	return x
+}
+
+/*
+ * signDeterministic signs hash with priv as ECDSA does, but derives the
+ * nonce from priv and hash with HMAC-SHA256 as in RFC 6979 instead of
+ * reading randomness. The same wallet signs the same transaction with
+ * the same bytes, which keeps simulations reproducible from a seed.
+ * The signature is ASN.1 encoded and checked by ecdsa.VerifyASN1.
+ */
+func signDeterministic(priv *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	params := priv.Curve.Params()
+	n := params.N
+	qlen := n.BitLen()
+	rolen := (qlen + 7) / 8
+
+	z := bits2int(hash, qlen)
+	if z.Cmp(n) >= 0 {
+		z.Sub(z, n)
+	}
+	seed := append(priv.D.FillBytes(make([]byte, rolen)), z.FillBytes(make([]byte, rolen))...)
+
+	mac := func(key []byte, data ...[]byte) []byte {
+		h := hmac.New(sha256.New, key)
+		for _, d := range data {
+			h.Write(d)
+		}
+		return h.Sum(nil)
+	}
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 1
+	}
+	k := make([]byte, sha256.Size)
+	k = mac(k, v, []byte{0}, seed)
+	v = mac(k, v)
+	k = mac(k, v, []byte{1}, seed)
+	v = mac(k, v)
+
+	for range 64 {
+		var t []byte
+		for len(t) < rolen {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+		nonce := bits2int(t[:rolen], qlen)
+		if nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+			x, _ := priv.Curve.ScalarBaseMult(nonce.FillBytes(make([]byte, rolen)))
+			r := new(big.Int).Mod(x, n)
+			if r.Sign() != 0 {
+				// s = nonce^-1 * (z + r * d) mod n
+				s := new(big.Int).Mul(r, priv.D)
+				s.Add(s, z)
+				s.Mul(s, new(big.Int).ModInverse(nonce, n))
+				s.Mod(s, n)
+				if s.Sign() != 0 {
+					return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+				}
+			}
+		}
+		k = mac(k, v, []byte{0})
+		v = mac(k, v)
+	}
+	return nil, fmt.Errorf("no valid nonce")
+}
@@ -0,0 +1,58 @@
+package currency
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+func TestSignDeterministic(t *testing.T) {
+	// RFC 6979 A.2.5, P-256 with SHA-256 of "sample"
+	d, _ := new(big.Int).SetString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721", 16)
+	wantR, _ := new(big.Int).SetString("EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716", 16)
+	wantS, _ := new(big.Int).SetString("F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8", 16)
+	priv := ecdsa.PrivateKey{D: d}
+	priv.PublicKey.Curve = elliptic.P256()
+	priv.PublicKey.X, priv.PublicKey.Y = priv.PublicKey.Curve.ScalarBaseMult(d.Bytes())
+
+	hash := sha256.Sum256([]byte("sample"))
+	sig, err := signDeterministic(&priv, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		t.Fatal(err)
+	}
+	if rs.R.Cmp(wantR) != 0 || rs.S.Cmp(wantS) != 0 {
+		t.Errorf("signature (%X, %X)", rs.R, rs.S)
+	}
+	if !ecdsa.VerifyASN1(&priv.PublicKey, hash[:], sig) {
+		t.Error("signature not verified")
+	}
+}
+
+func TestNewWalletFromSeed(t *testing.T) {
+	wallet1 := NewWalletFromSeed([32]byte{1})
+	wallet2 := NewWalletFromSeed([32]byte{1})
+	if wallet1.GetAddress() != wallet2.GetAddress() {
+		t.Error("same seed, different addresses")
+	}
+	if wallet3 := NewWalletFromSeed([32]byte{2}); wallet3.GetAddress() == wallet1.GetAddress() {
+		t.Error("different seeds, same address")
+	}
+
+	txData := TxData{TxOuts: []TxOut{{Address: wallet1.GetAddress(), Amount: 1}}}
+	txn1 := wallet1.SignTxData(txData, 0)
+	txn2 := wallet2.SignTxData(txData, 0)
+	if !bytes.Equal(txn1.Witness.GetSig(), txn2.Witness.GetSig()) {
+		t.Error("same transaction, different signatures")
+	}
+	if err := txn1.Validate(); err != nil {
+		t.Error(err)
+	}
+}
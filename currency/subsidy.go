@@ -0,0 +1,25 @@
+package currency
+
+// Subsidy is the newly issued amount the coinbase of the block at height may claim
+func Subsidy(height uint64) uint64 {
+	params := &ActiveParams
+	var subsidy uint64
+	if halvings := height / params.HalvingInterval; halvings < 64 {
+		subsidy = params.InitialSubsidy >> halvings
+	}
+	return max(subsidy, params.TailEmission)
+}
+
+// TotalSupply is the amount issued by the blocks below height
+func TotalSupply(height uint64) uint64 {
+	interval := ActiveParams.HalvingInterval
+	var supply uint64
+	for start := uint64(0); start < height; start += interval {
+		n := min(interval, height-start)
+		supply += n * Subsidy(start)
+		if Subsidy(start) == 0 {
+			break
+		}
+	}
+	return supply
+}
@@ -0,0 +1,81 @@
+package currency
+
+import (
+	"gcoin/util"
+	"testing"
+)
+
+func TestSubsidy(t *testing.T) {
+	params := ActiveParams
+	defer func() { ActiveParams = params }()
+	ActiveParams.InitialSubsidy = 50
+	ActiveParams.HalvingInterval = 10
+	ActiveParams.TailEmission = 0
+
+	if s := Subsidy(9); s != 50 {
+		t.Errorf("Subsidy(9) == %d", s)
+	}
+	if s := Subsidy(10); s != 25 {
+		t.Errorf("Subsidy(10) == %d", s)
+	}
+	if s := TotalSupply(25); s != 10*50+10*25+5*12 {
+		t.Errorf("TotalSupply(25) == %d", s)
+	}
+	if TotalSupply(1000) != TotalSupply(10000) {
+		t.Errorf("supply is not capped")
+	}
+
+	ActiveParams.TailEmission = 1
+	if s := Subsidy(1000); s != 1 {
+		t.Errorf("Subsidy(1000) == %d", s)
+	}
+	if TotalSupply(1001) != TotalSupply(1000)+1 {
+		t.Errorf("tail emission not issued")
+	}
+
+	invalid := ActiveParams
+	invalid.HalvingInterval = 0
+	if err := SetActiveParams(invalid); err == nil || ActiveParams.HalvingInterval == 0 {
+		t.Error("halving interval 0 accepted")
+	}
+}
+
+func TestValidatedUtxoDbFromChain(t *testing.T) {
+	wallet := NewWallet()
+	chain, _ := newMaturedChain(wallet.GetAddress())
+	utxoDb, err := NewValidatedUtxoDbFromChain(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utxoDb.ValidateSupply(); err != nil {
+		t.Error(err)
+	}
+
+	b := chain.NextUnmintedBlock(NewBlockTransactions([]RegularTransaction{}, wallet.GetAddress(), 0, util.SystemClock{}), util.SystemClock{})
+	if err := b.Validate(util.SystemClock{}); err == nil {
+		t.Error("height mismatch")
+	}
+	bt := NewBlockTransactions([]RegularTransaction{}, wallet.GetAddress(), utxoDb.Height(), util.SystemClock{})
+	bt.CTxn = NewCoinbaseTransaction(wallet.GetAddress(), bt.CTxn.Amount()+1, util.SystemClock{})
+	b = chain.NextUnmintedBlock(bt, util.SystemClock{})
+	if err := utxoDb.ConnectBlock(&b); err == nil {
+		t.Error("reward mismatch")
+	}
+
+	// A second output, beyond the reward
+	bt = NewBlockTransactions([]RegularTransaction{}, wallet.GetAddress(), utxoDb.Height(), util.SystemClock{})
+	bt.CTxn.TxData.TxOuts = append(bt.CTxn.TxData.TxOuts, TxOut{Address: wallet.GetAddress(), Amount: DEFAULT_COINBASE_AMOUNT})
+	bt.CTxn.TxId = bt.CTxn.TxData.Hash()
+	b = chain.NextUnmintedBlock(bt, util.SystemClock{})
+	if err := utxoDb.ConnectBlock(&b); err == nil {
+		t.Error("second coinbase output")
+	}
+
+	// Outputs that were never issued
+	utxoDb.addEntry(OutPoint{}, UtxoEntry{TxOut: TxOut{Address: wallet.GetAddress(), Amount: DEFAULT_COINBASE_AMOUNT}})
+	height := utxoDb.Height()
+	b = chain.NextUnmintedBlock(NewBlockTransactions([]RegularTransaction{}, wallet.GetAddress(), height, util.SystemClock{}), util.SystemClock{})
+	if err := utxoDb.ConnectBlock(&b); err == nil || utxoDb.Height() != height {
+		t.Errorf("supply exceeded, %v", err)
+	}
+}
@@ -3,113 +3,260 @@ package currency
 import (
 	"cmp"
 	"fmt"
+	"maps"
 	"slices"
 )
 
+type UtxoEntry struct {
+	TxOut    TxOut
+	Height   uint64 // Height of the block that created the output
+	Coinbase bool   // Whether the output is created by a coinbase transaction
+}
+
 type UtxoDb struct {
-	uTxIns       map[Address]map[TxIn]struct{}
-	mapTxInTxOut map[TxIn]TxOut
+	uTxIns           map[Address]map[OutPoint]struct{}
+	mapOutPointEntry map[OutPoint]UtxoEntry
+	height           uint64  // Height of the next block to be connected
+	timestamps       []int64 // Timestamps of the last MEDIAN_TIME_SPAN blocks
+	total            uint64  // Amount of the unspent outputs
 }
 
 // Assume validated
 func (utxoDb *UtxoDb) UpdateTxData(txData *TxData) {
+	utxoDb.updateTxData(txData, false)
+}
+
+// coinbase is whether txData is the first transaction of its block
+func (utxoDb *UtxoDb) updateTxData(txData *TxData, coinbase bool) {
 	for _, txIn := range txData.TxIns {
-		txOut := utxoDb.mapTxInTxOut[txIn]
-		delete(utxoDb.uTxIns[txOut.Address], txIn)
+		utxoDb.spendEntry(txIn.OutPoint)
 	}
 
 	txId := txData.Hash()
 	for i, txOut := range txData.TxOuts {
-		txIn := TxIn{TxId: txId, OutIdx: uint64(i)}
-		s, ok := utxoDb.uTxIns[txOut.Address]
-		if !ok {
-			s = make(map[TxIn]struct{})
-			utxoDb.uTxIns[txOut.Address] = s
-		}
-		s[txIn] = struct{}{}
-		utxoDb.mapTxInTxOut[txIn] = txOut
+		outPoint := OutPoint{TxId: txId, OutIdx: uint64(i)}
+		utxoDb.addEntry(outPoint, UtxoEntry{TxOut: txOut, Height: utxoDb.height, Coinbase: coinbase})
 	}
 }
 
 // Assume UpdateTxData(txData) is called prior
 func (utxoDb *UtxoDb) UndoUpdateTxData(txData *TxData) {
 	for _, txIn := range txData.TxIns {
-		txOut := utxoDb.mapTxInTxOut[txIn]
-		utxoDb.uTxIns[txOut.Address][txIn] = struct{}{}
+		utxoDb.addEntry(txIn.OutPoint, utxoDb.mapOutPointEntry[txIn.OutPoint])
 	}
 
 	txId := txData.Hash()
-	for i, txOut := range txData.TxOuts {
-		txIn := TxIn{TxId: txId, OutIdx: uint64(i)}
-		delete(utxoDb.uTxIns[txOut.Address], txIn)
+	for i := range txData.TxOuts {
+		utxoDb.spendEntry(OutPoint{TxId: txId, OutIdx: uint64(i)})
 	}
 }
 
-func (utxoDb *UtxoDb) UpdateFromBlockTransactions(bt *BlockTransactions) {
-	utxoDb.UpdateTxData(&bt.CTxn.TxData)
+// Assume b is validated against the chain
+func (utxoDb *UtxoDb) UpdateFromBlock(b *Block) {
+	bt := &b.Data
+	utxoDb.updateTxData(&bt.CTxn.TxData, true)
 	for _, txn := range bt.RTxns {
 		utxoDb.UpdateTxData(&txn.TxData)
 	}
+	utxoDb.advance(b.BlockHeader.Timestamp)
 }
 
-// Assume txn.Validate() == nil
-func (utxoDb *UtxoDb) ValidateRegularTransaction(txn *RegularTransaction) error {
-	var transactionFee uint64
-	address := txn.Witness.GetAddress()
-	s := utxoDb.uTxIns[address]
-	for _, txIn := range txn.TxData.TxIns {
-		_, ok := s[txIn]
-		if !ok {
-			return fmt.Errorf("txIn %v invalid", txIn)
-		}
-		txOut, ok := utxoDb.mapTxInTxOut[txIn]
-		if !ok {
-			return fmt.Errorf("txIn %v no txOut", txIn)
-		}
-		transactionFee += txOut.Amount
+// ConnectBlock validates the transactions of b in order on an overlay
+// and commits them. The UtxoDb is left unchanged if any of them is invalid,
+// or the unspent outputs would exceed the supply issued up to b.
+func (utxoDb *UtxoDb) ConnectBlock(b *Block) error {
+	bt := &b.Data
+	if bt.Height != utxoDb.height {
+		return fmt.Errorf("height %d != %d", bt.Height, utxoDb.height)
 	}
-	for _, txOut := range txn.TxData.TxOuts {
-		if transactionFee >= txOut.Amount {
-			transactionFee -= txOut.Amount
-		} else {
-			return fmt.Errorf("not enough funds")
+	if err := bt.Validate(); err != nil {
+		return err
+	}
+	overlay := NewUtxoOverlay(utxoDb)
+	overlay.updateTxData(bt.CTxn.TxId, &bt.CTxn.TxData, true)
+	for i, txn := range bt.RTxns {
+		if err := ValidateRegularTransaction(overlay, &txn); err != nil {
+			return fmt.Errorf("%d: %w", i, err)
 		}
+		overlay.UpdateTxData(txn.TxId, &txn.TxData)
+	}
+
+	total := utxoDb.total
+	for _, entry := range overlay.added {
+		total += entry.TxOut.Amount
 	}
-	if transactionFee != txn.TransactionFee {
-		return fmt.Errorf("transactionFee mismatch")
+	for outPoint := range overlay.spent {
+		entry, _ := utxoDb.Entry(outPoint)
+		total -= entry.TxOut.Amount
 	}
+	if supply := TotalSupply(utxoDb.height + 1); total > supply {
+		return fmt.Errorf("total %d exceeds supply %d", total, supply)
+	}
+	overlay.Commit()
+	utxoDb.advance(b.BlockHeader.Timestamp)
 	return nil
 }
 
+// ValidateSupply checks that the unspent outputs do not exceed
+// what the connected blocks have issued
+func (utxoDb *UtxoDb) ValidateSupply() error {
+	var total uint64
+	for address := range utxoDb.uTxIns {
+		mature, immature := utxoDb.Funds(address)
+		total += mature + immature
+	}
+	if supply := TotalSupply(utxoDb.height); total > supply {
+		return fmt.Errorf("total %d exceeds supply %d", total, supply)
+	}
+	return nil
+}
+
+func (utxoDb *UtxoDb) advance(timestamp int64) {
+	utxoDb.height++
+	utxoDb.timestamps = append(utxoDb.timestamps, timestamp)
+	if len(utxoDb.timestamps) > MEDIAN_TIME_SPAN {
+		utxoDb.timestamps = utxoDb.timestamps[1:]
+	}
+}
+
+// Height of the next block to be connected
+func (utxoDb *UtxoDb) Height() uint64 {
+	return utxoDb.height
+}
+
+// MedianTime is the median timestamp of the last MEDIAN_TIME_SPAN blocks
+func (utxoDb *UtxoDb) MedianTime() int64 {
+	n := len(utxoDb.timestamps)
+	if n == 0 {
+		return 0
+	}
+	timestamps := slices.Clone(utxoDb.timestamps)
+	slices.Sort(timestamps)
+	return timestamps[n/2]
+}
+
+// Entry returns the unspent output at outPoint
+func (utxoDb *UtxoDb) Entry(outPoint OutPoint) (UtxoEntry, bool) {
+	entry, ok := utxoDb.mapOutPointEntry[outPoint]
+	if !ok {
+		return entry, false
+	}
+	_, ok = utxoDb.uTxIns[entry.TxOut.Address][outPoint]
+	return entry, ok
+}
+
+func (utxoDb *UtxoDb) addEntry(outPoint OutPoint, entry UtxoEntry) {
+	s, ok := utxoDb.uTxIns[entry.TxOut.Address]
+	if !ok {
+		s = make(map[OutPoint]struct{})
+		utxoDb.uTxIns[entry.TxOut.Address] = s
+	}
+	if _, ok := s[outPoint]; !ok {
+		utxoDb.total += entry.TxOut.Amount
+	}
+	s[outPoint] = struct{}{}
+	utxoDb.mapOutPointEntry[outPoint] = entry
+}
+
+func (utxoDb *UtxoDb) spendEntry(outPoint OutPoint) {
+	entry := utxoDb.mapOutPointEntry[outPoint]
+	if _, ok := utxoDb.uTxIns[entry.TxOut.Address][outPoint]; ok {
+		utxoDb.total -= entry.TxOut.Amount
+		delete(utxoDb.uTxIns[entry.TxOut.Address], outPoint)
+	}
+}
+
+// OutPoints returns the unspent outputs of address in a stable order
+func (utxoDb *UtxoDb) OutPoints(address Address) []OutPoint {
+	outPoints := make([]OutPoint, 0, len(utxoDb.uTxIns[address]))
+	for outPoint := range utxoDb.uTxIns[address] {
+		outPoints = append(outPoints, outPoint)
+	}
+	slices.SortFunc(outPoints, CompareOutPoints)
+	return outPoints
+}
+
+func (utxoDb *UtxoDb) IsMature(entry UtxoEntry) bool {
+	return IsMature(utxoDb, entry)
+}
+
+func (utxoDb *UtxoDb) ValidateTimeLocks(txData *TxData) error {
+	return ValidateTimeLocks(utxoDb, txData)
+}
+
+func (utxoDb *UtxoDb) ValidateRegularTransaction(txn *RegularTransaction) error {
+	return ValidateRegularTransaction(utxoDb, txn)
+}
+
+// FilterRegularTransactions selects the transactions of mempool that connect
+// in order. The UtxoDb is not modified.
 func (utxoDb *UtxoDb) FilterRegularTransactions(mempool []RegularTransaction) []RegularTransaction {
 	var txns []RegularTransaction
+	overlay := NewUtxoOverlay(utxoDb)
 	for _, txn := range mempool {
-		if err := utxoDb.ValidateRegularTransaction(&txn); err != nil {
+		if err := ValidateRegularTransaction(overlay, &txn); err != nil {
 			continue
 		}
-		utxoDb.UpdateTxData(&txn.TxData)
+		overlay.UpdateTxData(txn.TxId, &txn.TxData)
 		txns = append(txns, txn)
 	}
-
-	for _, txn := range txns {
-		utxoDb.UndoUpdateTxData(&txn.TxData)
-	}
 	return txns
 }
 
+func (utxoDb *UtxoDb) Funds(address Address) (uint64, uint64) {
+	return Funds(utxoDb, address)
+}
+
+// AvailableFunds excludes immature coinbase outputs
 func (utxoDb *UtxoDb) AvailableFunds(address Address) uint64 {
-	if uTxIns, ok := utxoDb.uTxIns[address]; ok {
-		var funds uint64
-		for txIn := range uTxIns {
-			if txOut, ok := utxoDb.mapTxInTxOut[txIn]; ok {
-				funds += txOut.Amount
-			} else {
-				panic(fmt.Errorf("txIn %v not found", txIn))
-			}
+	mature, _ := utxoDb.Funds(address)
+	return mature
+}
+
+// Mismatch reports the first difference between the unspent outputs of
+// utxoDb and other, nil if both hold the same entries at the same height
+func (utxoDb *UtxoDb) Mismatch(other *UtxoDb) error {
+	if utxoDb.height != other.height {
+		return fmt.Errorf("height %d != %d", utxoDb.height, other.height)
+	}
+	outPoints := utxoDb.unspent()
+	for _, outPoint := range outPoints {
+		entry, _ := utxoDb.Entry(outPoint)
+		if otherEntry, ok := other.Entry(outPoint); !ok || otherEntry != entry {
+			return fmt.Errorf("%v: %+v != %+v", outPoint, entry, otherEntry)
 		}
-		return funds
 	}
-	return 0
+	// Every output of utxoDb is in other, so other has extra ones if more
+	if n := len(other.unspent()); n != len(outPoints) {
+		return fmt.Errorf("%d unspent outputs != %d", len(outPoints), n)
+	}
+	return nil
+}
+
+// Clone copies utxoDb, so that blocks can be connected to the copy alone
+func (utxoDb *UtxoDb) Clone() UtxoDb {
+	uTxIns := make(map[Address]map[OutPoint]struct{}, len(utxoDb.uTxIns))
+	for address, s := range utxoDb.uTxIns {
+		uTxIns[address] = maps.Clone(s)
+	}
+	return UtxoDb{
+		uTxIns:           uTxIns,
+		mapOutPointEntry: maps.Clone(utxoDb.mapOutPointEntry),
+		height:           utxoDb.height,
+		timestamps:       slices.Clone(utxoDb.timestamps),
+		total:            utxoDb.total}
+}
+
+// unspent returns every unspent output in a stable order
+func (utxoDb *UtxoDb) unspent() []OutPoint {
+	var outPoints []OutPoint
+	for _, s := range utxoDb.uTxIns {
+		for outPoint := range s {
+			outPoints = append(outPoints, outPoint)
+		}
+	}
+	slices.SortFunc(outPoints, CompareOutPoints)
+	return outPoints
 }
 
 type Tally TxOut
@@ -117,7 +264,8 @@ type Tally TxOut
 func (utxoDb *UtxoDb) Summary() []Tally {
 	var tallies []Tally
 	for address := range utxoDb.uTxIns {
-		amount := utxoDb.AvailableFunds(address)
+		mature, immature := utxoDb.Funds(address)
+		amount := mature + immature
 		tallies = append(tallies, Tally{Address: address, Amount: amount})
 	}
 	slices.SortFunc(tallies, func(a Tally, b Tally) int {
@@ -128,14 +276,27 @@ func (utxoDb *UtxoDb) Summary() []Tally {
 
 func NewUtxoDb() UtxoDb {
 	return UtxoDb{
-		uTxIns:       make(map[Address]map[TxIn]struct{}),
-		mapTxInTxOut: make(map[TxIn]TxOut)}
+		uTxIns:           make(map[Address]map[OutPoint]struct{}),
+		mapOutPointEntry: make(map[OutPoint]UtxoEntry)}
 }
 
+// Assume chain is validated
 func NewUtxoDbFromChain(chain Chain) UtxoDb {
 	utxoDb := NewUtxoDb()
-	for _, b := range chain {
-		utxoDb.UpdateFromBlockTransactions(&b.Data)
+	for i := range chain {
+		utxoDb.UpdateFromBlock(&chain[i])
 	}
 	return utxoDb
 }
+
+// NewValidatedUtxoDbFromChain is NewUtxoDbFromChain but connects
+// every block with ConnectBlock
+func NewValidatedUtxoDbFromChain(chain Chain) (UtxoDb, error) {
+	utxoDb := NewUtxoDb()
+	for i := range chain {
+		if err := utxoDb.ConnectBlock(&chain[i]); err != nil {
+			return utxoDb, fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+	return utxoDb, utxoDb.ValidateSupply()
+}
@@ -2,18 +2,29 @@ package currency
 
 import (
 	"gcoin/blockchain"
+	"gcoin/util"
 	"testing"
 )
 
+// newMaturedChain pays address in the genesis block and extends the chain
+// until that coinbase output can be spent in the next block
+func newMaturedChain(address Address) (Chain, BlockTransactions) {
+	bt := NewBlockTransactions([]RegularTransaction{}, address, 0, util.SystemClock{})
+	s := []BlockTransactions{bt}
+	for i := range ActiveParams.CoinbaseMaturity - 1 {
+		s = append(s, NewBlockTransactions([]RegularTransaction{}, util.NewHash(i), i+1, util.SystemClock{}))
+	}
+	return blockchain.NewChain(s, util.SystemClock{}), bt
+}
+
 func TestValidateRegularTransaction(t *testing.T) {
 	wallet1 := NewWallet()
 	wallet2 := NewWallet()
 
-	bt := NewBlockTransactions([]RegularTransaction{}, wallet1.GetAddress())
-	chain := blockchain.NewChain([]BlockTransactions{bt})
+	chain, _ := newMaturedChain(wallet1.GetAddress())
 	utxoDb := NewUtxoDbFromChain(chain)
 
-	rt, err := wallet1.MakeRegularTransaction(&utxoDb, wallet2.GetAddress(), 5, 1)
+	rt, err := wallet1.MakeRegularTransaction(&utxoDb, wallet2.GetAddress(), 5, 1, util.SystemClock{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -35,3 +46,123 @@ func TestValidateRegularTransaction(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestMismatch(t *testing.T) {
+	wallet := NewWallet()
+	chain, _ := newMaturedChain(wallet.GetAddress())
+	utxoDb := NewUtxoDbFromChain(chain)
+	other := NewUtxoDbFromChain(chain)
+	if err := utxoDb.Mismatch(&other); err != nil {
+		t.Error(err)
+	}
+
+	rt, err := wallet.MakeRegularTransaction(&utxoDb, wallet.GetAddress(), 1, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Spent in other alone, which holds its outputs instead
+	other.UpdateTxData(&rt.TxData)
+	if err := utxoDb.Mismatch(&other); err == nil {
+		t.Error("spent output not reported")
+	}
+	if err := other.Mismatch(&utxoDb); err == nil {
+		t.Error("new outputs not reported")
+	}
+
+	clone := utxoDb.Clone()
+	clone.UpdateTxData(&rt.TxData)
+	if err := clone.Mismatch(&other); err != nil {
+		t.Error(err)
+	}
+	if err := utxoDb.Mismatch(&other); err == nil {
+		t.Error("clone shares outputs")
+	}
+}
+
+func TestValidateTimeLocks(t *testing.T) {
+	wallet1 := NewWallet()
+	wallet2 := NewWallet()
+
+	chain, bt := newMaturedChain(wallet1.GetAddress())
+	utxoDb := NewUtxoDbFromChain(chain)
+	height := utxoDb.Height()
+
+	outPoint := OutPoint{TxId: bt.CTxn.TxId, OutIdx: 0}
+	txData := TxData{
+		TxIns:    []TxIn{{OutPoint: outPoint}},
+		TxOuts:   []TxOut{{Address: wallet2.GetAddress(), Amount: DEFAULT_COINBASE_AMOUNT - 1}},
+		LockTime: height + 1}
+	rt := wallet1.SignTxData(txData, 1)
+	if err := utxoDb.ValidateRegularTransaction(&rt); err == nil {
+		t.Error("lockTime ignored")
+	}
+
+	txData.LockTime = height
+	rt = wallet1.SignTxData(txData, 1)
+	if err := utxoDb.ValidateRegularTransaction(&rt); err != nil {
+		t.Error(err)
+	}
+
+	txData.TxIns[0].Sequence = height + 1
+	rt = wallet1.SignTxData(txData, 1)
+	if err := utxoDb.ValidateRegularTransaction(&rt); err == nil {
+		t.Error("sequence ignored")
+	}
+
+	txData.TxIns[0].Sequence = height
+	rt = wallet1.SignTxData(txData, 1)
+	if err := utxoDb.ValidateRegularTransaction(&rt); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	wallet := NewWallet()
+
+	chain, bt := newMaturedChain(wallet.GetAddress())
+	utxoDb := NewUtxoDbFromChain(chain[:len(chain)-1])
+	if available, immature := wallet.AvailableFunds(&utxoDb); available != 0 || immature != bt.CTxn.Amount() {
+		t.Errorf("funds %d %d", available, immature)
+	}
+	if _, err := wallet.MakeRegularTransaction(&utxoDb, util.Hash{}, 1, 1, util.SystemClock{}); err == nil {
+		t.Error("spent immature coinbase")
+	}
+
+	utxoDb.UpdateFromBlock(&chain[len(chain)-1])
+	if available, immature := wallet.AvailableFunds(&utxoDb); available != bt.CTxn.Amount() || immature != 0 {
+		t.Errorf("funds %d %d", available, immature)
+	}
+	rt, err := wallet.MakeRegularTransaction(&utxoDb, util.Hash{}, 1, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utxoDb.ValidateRegularTransaction(rt); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCoinbaseInputs(t *testing.T) {
+	victim := NewWallet()
+	miner := NewWallet()
+
+	chain, bt := newMaturedChain(victim.GetAddress())
+	utxoDb := NewUtxoDbFromChain(chain)
+	height := utxoDb.Height()
+
+	// Takes the victim's coinbase output without a witness
+	outPoint := OutPoint{TxId: bt.CTxn.TxId, OutIdx: 0}
+	txData := TxData{
+		TxIns:  []TxIn{{OutPoint: outPoint}},
+		TxOuts: []TxOut{{Address: miner.GetAddress(), Amount: Subsidy(height)}}}
+	cbt := BlockTransactions{Height: height, CTxn: CoinbaseTransaction{TxId: txData.Hash(), TxData: txData}}
+	if err := cbt.Validate(); err == nil {
+		t.Error("coinbase with txIns validated")
+	}
+	b := chain.NextUnmintedBlock(cbt, util.SystemClock{})
+	if err := utxoDb.ConnectBlock(&b); err == nil || utxoDb.Height() != height {
+		t.Errorf("coinbase with txIns connected, %v", err)
+	}
+	if _, ok := utxoDb.Entry(outPoint); !ok {
+		t.Error("victim's output spent")
+	}
+}
@@ -0,0 +1,205 @@
+package currency
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// UtxoView is a read-only set of unspent outputs as of the next block
+type UtxoView interface {
+	Height() uint64    // Height of the next block
+	MedianTime() int64 // Median time past of the next block
+	Entry(outPoint OutPoint) (UtxoEntry, bool)
+	OutPoints(address Address) []OutPoint
+}
+
+func CompareOutPoints(a OutPoint, b OutPoint) int {
+	if c := bytes.Compare(a.TxId[:], b.TxId[:]); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.OutIdx, b.OutIdx)
+}
+
+// IsMature reports whether entry can be spent in the next block
+func IsMature(view UtxoView, entry UtxoEntry) bool {
+	return !entry.Coinbase || view.Height() >= entry.Height+ActiveParams.CoinbaseMaturity
+}
+
+// ValidateTimeLocks checks txData against the next block.
+// Inputs unknown to the view are skipped.
+func ValidateTimeLocks(view UtxoView, txData *TxData) error {
+	height := view.Height()
+	if !txData.IsFinal(height, view.MedianTime()) {
+		return fmt.Errorf("lockTime %d not reached", txData.LockTime)
+	}
+	for _, txIn := range txData.TxIns {
+		if txIn.Sequence == 0 {
+			continue
+		}
+		entry, ok := view.Entry(txIn.OutPoint)
+		if !ok {
+			continue
+		}
+		if height < entry.Height+txIn.Sequence {
+			return fmt.Errorf("txIn %v sequence %d not reached", txIn.OutPoint, txIn.Sequence)
+		}
+	}
+	return nil
+}
+
+// Assume txn.Validate() == nil
+func ValidateRegularTransaction(view UtxoView, txn *RegularTransaction) error {
+	var transactionFee uint64
+	address := txn.Witness.GetAddress()
+	for _, txIn := range txn.TxData.TxIns {
+		entry, ok := view.Entry(txIn.OutPoint)
+		if !ok || entry.TxOut.Address != address {
+			return fmt.Errorf("txIn %v invalid", txIn.OutPoint)
+		}
+		if !IsMature(view, entry) {
+			return fmt.Errorf("txIn %v immature coinbase", txIn.OutPoint)
+		}
+		transactionFee += entry.TxOut.Amount
+	}
+	for _, txOut := range txn.TxData.TxOuts {
+		if transactionFee >= txOut.Amount {
+			transactionFee -= txOut.Amount
+		} else {
+			return fmt.Errorf("not enough funds")
+		}
+	}
+	if transactionFee != txn.TransactionFee {
+		return fmt.Errorf("transactionFee mismatch")
+	}
+	return ValidateTimeLocks(view, &txn.TxData)
+}
+
+// Funds returns the amounts of address that are spendable and
+// that are locked in immature coinbase outputs
+func Funds(view UtxoView, address Address) (uint64, uint64) {
+	var mature, immature uint64
+	for _, outPoint := range view.OutPoints(address) {
+		entry, ok := view.Entry(outPoint)
+		if !ok {
+			panic(fmt.Errorf("outPoint %v not found", outPoint))
+		}
+		if IsMature(view, entry) {
+			mature += entry.TxOut.Amount
+		} else {
+			immature += entry.TxOut.Amount
+		}
+	}
+	return mature, immature
+}
+
+// MutableUtxoView is a UtxoView that a UtxoOverlay can be committed into
+type MutableUtxoView interface {
+	UtxoView
+	addEntry(outPoint OutPoint, entry UtxoEntry)
+	spendEntry(outPoint OutPoint)
+}
+
+/*
+ * UtxoOverlay records changes over a parent UtxoView without touching it.
+ *
+ * Speculative validation, such as selecting transactions for a block,
+ * applies transactions to an overlay and either commits the result into
+ * the parent or simply drops the overlay. Overlays can be stacked.
+ */
+type UtxoOverlay struct {
+	parent UtxoView
+	added  map[OutPoint]UtxoEntry
+	spent  map[OutPoint]struct{} // Spent outputs of the parent
+}
+
+func NewUtxoOverlay(parent UtxoView) *UtxoOverlay {
+	return &UtxoOverlay{
+		parent: parent,
+		added:  make(map[OutPoint]UtxoEntry),
+		spent:  make(map[OutPoint]struct{})}
+}
+
+func (overlay *UtxoOverlay) Height() uint64 {
+	return overlay.parent.Height()
+}
+
+func (overlay *UtxoOverlay) MedianTime() int64 {
+	return overlay.parent.MedianTime()
+}
+
+func (overlay *UtxoOverlay) Entry(outPoint OutPoint) (UtxoEntry, bool) {
+	if entry, ok := overlay.added[outPoint]; ok {
+		return entry, true
+	}
+	if _, ok := overlay.spent[outPoint]; ok {
+		return UtxoEntry{}, false
+	}
+	return overlay.parent.Entry(outPoint)
+}
+
+func (overlay *UtxoOverlay) OutPoints(address Address) []OutPoint {
+	var outPoints []OutPoint
+	for _, outPoint := range overlay.parent.OutPoints(address) {
+		if _, ok := overlay.spent[outPoint]; !ok {
+			outPoints = append(outPoints, outPoint)
+		}
+	}
+	for outPoint, entry := range overlay.added {
+		if entry.TxOut.Address == address {
+			outPoints = append(outPoints, outPoint)
+		}
+	}
+	slices.SortFunc(outPoints, CompareOutPoints)
+	return outPoints
+}
+
+func (overlay *UtxoOverlay) addEntry(outPoint OutPoint, entry UtxoEntry) {
+	overlay.added[outPoint] = entry
+}
+
+func (overlay *UtxoOverlay) spendEntry(outPoint OutPoint) {
+	if _, ok := overlay.added[outPoint]; ok {
+		delete(overlay.added, outPoint)
+	} else {
+		overlay.spent[outPoint] = struct{}{}
+	}
+}
+
+// Assume validated, txId included
+func (overlay *UtxoOverlay) UpdateTxData(txId TxId, txData *TxData) {
+	overlay.updateTxData(txId, txData, false)
+}
+
+// coinbase is whether txData is the first transaction of its block
+func (overlay *UtxoOverlay) updateTxData(txId TxId, txData *TxData, coinbase bool) {
+	for _, txIn := range txData.TxIns {
+		overlay.spendEntry(txIn.OutPoint)
+	}
+	for i, txOut := range txData.TxOuts {
+		entry := UtxoEntry{TxOut: txOut, Height: overlay.Height(), Coinbase: coinbase}
+		overlay.addEntry(OutPoint{TxId: txId, OutIdx: uint64(i)}, entry)
+	}
+}
+
+// Commit applies the changes to the parent, which must be a MutableUtxoView
+func (overlay *UtxoOverlay) Commit() {
+	parent, ok := overlay.parent.(MutableUtxoView)
+	if !ok {
+		panic(fmt.Errorf("commit into read-only %T", overlay.parent))
+	}
+	for outPoint := range overlay.spent {
+		parent.spendEntry(outPoint)
+	}
+	for outPoint, entry := range overlay.added {
+		parent.addEntry(outPoint, entry)
+	}
+	overlay.Discard()
+}
+
+// Discard drops the changes
+func (overlay *UtxoOverlay) Discard() {
+	clear(overlay.added)
+	clear(overlay.spent)
+}
@@ -0,0 +1,48 @@
+package currency
+
+import (
+	"gcoin/util"
+	"testing"
+)
+
+func TestUtxoOverlay(t *testing.T) {
+	wallet := NewWallet()
+	chain, _ := newMaturedChain(wallet.GetAddress())
+	utxoDb := NewUtxoDbFromChain(chain)
+
+	overlay := NewUtxoOverlay(&utxoDb)
+	rt, err := wallet.MakeRegularTransaction(overlay, wallet.GetAddress(), 1, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateRegularTransaction(overlay, rt); err != nil {
+		t.Fatal(err)
+	}
+	overlay.UpdateTxData(rt.TxId, &rt.TxData)
+	if err := ValidateRegularTransaction(overlay, rt); err == nil {
+		t.Error("duplicate found")
+	}
+
+	// A nested overlay sees the change but the UtxoDb does not
+	nested := NewUtxoOverlay(overlay)
+	if funds, _ := wallet.AvailableFunds(nested); funds != DEFAULT_COINBASE_AMOUNT-1 {
+		t.Errorf("funds %d", funds)
+	}
+	if err := utxoDb.ValidateRegularTransaction(rt); err != nil {
+		t.Error(err)
+	}
+
+	overlay.Discard()
+	if err := ValidateRegularTransaction(overlay, rt); err != nil {
+		t.Error(err)
+	}
+
+	overlay.UpdateTxData(rt.TxId, &rt.TxData)
+	overlay.Commit()
+	if err := utxoDb.ValidateRegularTransaction(rt); err == nil {
+		t.Error("not committed")
+	}
+	if funds := utxoDb.AvailableFunds(wallet.GetAddress()); funds != DEFAULT_COINBASE_AMOUNT-1 {
+		t.Errorf("funds %d", funds)
+	}
+}
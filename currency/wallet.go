@@ -6,7 +6,9 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
-	"time"
+	"gcoin/util"
+	"math/big"
+	"slices"
 )
 
 /*
@@ -23,6 +25,21 @@ func NewWallet() Wallet {
 	return Wallet(*priv)
 }
 
+// NewWalletFromSeed derives the private key from seed, so that
+// simulations replay with the same addresses
+func NewWalletFromSeed(seed [32]byte) Wallet {
+	curve := elliptic.P256()
+	n := curve.Params().N
+	h := sha256.Sum256(seed[:])
+	d := new(big.Int).SetBytes(h[:])
+	d.Mod(d, new(big.Int).Sub(n, big.NewInt(1)))
+	d.Add(d, big.NewInt(1)) // In [1, n-1]
+	priv := ecdsa.PrivateKey{D: d}
+	priv.PublicKey.Curve = curve
+	priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	return Wallet(priv)
+}
+
 func (wallet *Wallet) GetPub() []byte {
 	pub := wallet.PublicKey
 	return elliptic.MarshalCompressed(pub.Curve, pub.X, pub.Y)
@@ -33,7 +50,7 @@ func (wallet *Wallet) GetAddress() Address {
 }
 
 func (wallet *Wallet) MakeWitness(txId TxId) Witness {
-	sig, err := ecdsa.SignASN1(rand.Reader, (*ecdsa.PrivateKey)(wallet), txId[:])
+	sig, err := signDeterministic((*ecdsa.PrivateKey)(wallet), txId[:])
 	if err != nil {
 		panic(err)
 	}
@@ -42,18 +59,29 @@ func (wallet *Wallet) MakeWitness(txId TxId) Witness {
 		pub: wallet.GetPub()}
 }
 
-func (wallet *Wallet) sourceTxIns(utxoDb *UtxoDb, txData *TxData, amount uint64) (uint64, error) {
+// AvailableFunds returns the spendable funds of wallet and,
+// separately, the funds still waiting for coinbase maturity
+func (wallet *Wallet) AvailableFunds(view UtxoView) (uint64, uint64) {
+	return Funds(view, wallet.GetAddress())
+}
+
+func (wallet *Wallet) sourceTxIns(view UtxoView, txData *TxData, amount uint64) (uint64, error) {
 	address := wallet.GetAddress()
-	for txIn := range utxoDb.uTxIns[address] {
-		txData.TxIns = append(txData.TxIns, txIn)
-		txOut, ok := utxoDb.mapTxInTxOut[txIn]
+	for _, outPoint := range view.OutPoints(address) {
+		entry, ok := view.Entry(outPoint)
 		if !ok {
-			return 0, fmt.Errorf("txIn %v invalid", txIn)
+			return 0, fmt.Errorf("outPoint %v invalid", outPoint)
 		}
-		if amount > txOut.Amount {
-			amount -= txOut.Amount
+		if !IsMature(view, entry) || slices.ContainsFunc(txData.TxIns, func(txIn TxIn) bool {
+			return txIn.OutPoint == outPoint
+		}) {
+			continue
+		}
+		txData.TxIns = append(txData.TxIns, TxIn{OutPoint: outPoint})
+		if amount > entry.TxOut.Amount {
+			amount -= entry.TxOut.Amount
 		} else {
-			return txOut.Amount - amount, nil
+			return entry.TxOut.Amount - amount, nil
 		}
 	}
 	if amount != 0 {
@@ -62,14 +90,16 @@ func (wallet *Wallet) sourceTxIns(utxoDb *UtxoDb, txData *TxData, amount uint64)
 	return 0, nil
 }
 
-func (wallet *Wallet) MakeRegularTransaction(utxoDb *UtxoDb, recvAddress Address, amount uint64, transactionFee uint64) (*RegularTransaction, error) {
+// MakeRegularTransaction spends the outputs of wallet in view, which may
+// include unconfirmed ones, to pay amount to recvAddress
+func (wallet *Wallet) MakeRegularTransaction(view UtxoView, recvAddress Address, amount uint64, transactionFee uint64, clock util.Clock) (*RegularTransaction, error) {
 	if amount == 0 {
 		return nil, fmt.Errorf("nothing to send")
 	}
 	txData := TxData{
 		TxOuts:    []TxOut{{Address: recvAddress, Amount: amount}},
-		Timestamp: time.Now().UnixMilli()}
-	if change, err := wallet.sourceTxIns(utxoDb, &txData, amount+transactionFee); err != nil {
+		Timestamp: clock.Now()}
+	if change, err := wallet.sourceTxIns(view, &txData, amount+transactionFee); err != nil {
 		return nil, err
 	} else {
 		if change != 0 {
@@ -77,11 +107,82 @@ func (wallet *Wallet) MakeRegularTransaction(utxoDb *UtxoDb, recvAddress Address
 			txData.TxOuts = append(txData.TxOuts, txOut)
 		}
 	}
+	txn := wallet.SignTxData(txData, transactionFee)
+	return &txn, nil
+}
+
+// MakeRegularTransactionForTarget is MakeRegularTransaction paying the fee
+// that est suggests for confirmation within target blocks
+func (wallet *Wallet) MakeRegularTransactionForTarget(view UtxoView, est FeeEstimator, recvAddress Address, amount uint64, target uint64, clock util.Clock) (*RegularTransaction, error) {
+	feeRate, err := est.EstimateFeeRate(target)
+	if err != nil {
+		return nil, err
+	}
+	// More inputs may be needed to pay for the fee, which grows the transaction
+	var transactionFee uint64
+	for {
+		txn, err := wallet.MakeRegularTransaction(view, recvAddress, amount, transactionFee, clock)
+		if err != nil {
+			return nil, err
+		}
+		fee := Fee(feeRate, txn.Size())
+		if fee <= transactionFee {
+			return txn, nil
+		}
+		transactionFee = fee
+	}
+}
+
+// SignTxData wraps txData into a RegularTransaction witnessed by wallet
+func (wallet *Wallet) SignTxData(txData TxData, transactionFee uint64) RegularTransaction {
 	txId := txData.Hash()
-	txn := RegularTransaction{
+	return RegularTransaction{
 		TransactionFee: transactionFee,
 		TxId:           txId,
 		TxData:         txData,
 		Witness:        wallet.MakeWitness(txId)}
-	return &txn, nil
+}
+
+// BumpFee re-signs the unconfirmed transaction txId with a higher transactionFee.
+// The difference is paid out of its change and, if that is short, more inputs
+// from view, which must not include the outputs of txId.
+func (wallet *Wallet) BumpFee(view UtxoView, txns TxLookup, txId TxId, transactionFee uint64, clock util.Clock) (*RegularTransaction, error) {
+	txn, ok := txns.Transaction(txId)
+	if !ok {
+		return nil, fmt.Errorf("txId %s not found", txId)
+	}
+	address := wallet.GetAddress()
+	if txn.Witness.GetAddress() != address {
+		return nil, fmt.Errorf("txId %s not signed by %s", txId, address)
+	}
+	if transactionFee <= txn.TransactionFee {
+		return nil, fmt.Errorf("transactionFee %d not above %d", transactionFee, txn.TransactionFee)
+	}
+
+	txData := TxData{
+		TxIns:     slices.Clone(txn.TxData.TxIns),
+		TxOuts:    slices.Clone(txn.TxData.TxOuts),
+		LockTime:  txn.TxData.LockTime,
+		Timestamp: clock.Now()}
+	delta := transactionFee - txn.TransactionFee
+	if change := util.Last(txData.TxOuts); len(txData.TxOuts) > 1 && change.Address == address {
+		if change.Amount > delta {
+			change.Amount -= delta
+			delta = 0
+		} else {
+			delta -= change.Amount
+			txData.TxOuts = txData.TxOuts[:len(txData.TxOuts)-1]
+		}
+	}
+	if delta != 0 {
+		change, err := wallet.sourceTxIns(view, &txData, delta)
+		if err != nil {
+			return nil, err
+		}
+		if change != 0 {
+			txData.TxOuts = append(txData.TxOuts, TxOut{Address: address, Amount: change})
+		}
+	}
+	bumped := wallet.SignTxData(txData, transactionFee)
+	return &bumped, nil
 }
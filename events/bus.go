@@ -0,0 +1,253 @@
+package events
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+const HISTORY_LEN = 4096       // Events kept for subscribers resuming from a sequence number
+const SUBSCRIBER_BUFFER = 256  // Events queued for a subscriber before it is dropped
+const SPENDS_LEN = HISTORY_LEN // Transactions whose spent outputs are kept for their later events and conflicts
+
+type Envelope struct {
+	Seq       uint64 // From 1, without gaps
+	Time      int64
+	Kind      string
+	Addresses []c.Address // Paid or spent by the event, matched by filters
+	Event     Event
+}
+
+// Tx is a transaction an event is filtered by the addresses of
+type Tx struct {
+	TxId   c.TxId
+	TxData *c.TxData
+}
+
+type Filter struct {
+	Addresses []c.Address // Empty to match every event
+}
+
+// Match is true for the events of any of the addresses, and for
+// the events not tied to addresses such as NewTip
+func (filter *Filter) Match(envelope *Envelope) bool {
+	if len(filter.Addresses) == 0 || len(envelope.Addresses) == 0 {
+		return true
+	}
+	for _, address := range envelope.Addresses {
+		if slices.Contains(filter.Addresses, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription delivers the matching events on C in sequence order.
+// C is closed by Close, or by the bus once SUBSCRIBER_BUFFER events are
+// queued, in which case Lagged is true and the subscriber may Resume
+// from the last sequence number it has seen.
+type Subscription struct {
+	C      <-chan Envelope
+	c      chan Envelope
+	filter Filter
+	lagged bool
+	bus    *Bus
+}
+
+func (sub *Subscription) Close() {
+	sub.bus.mu.Lock()
+	defer sub.bus.mu.Unlock()
+
+	if _, ok := sub.bus.subs[sub]; ok {
+		delete(sub.bus.subs, sub)
+		close(sub.c)
+	}
+}
+
+func (sub *Subscription) Lagged() bool {
+	sub.bus.mu.Lock()
+	defer sub.bus.mu.Unlock()
+
+	return sub.lagged
+}
+
+/*
+ * Bus fans the events of a node out to subscribers.
+ *
+ * Publishing never blocks: a subscriber that falls SUBSCRIBER_BUFFER
+ * events behind is dropped. The last HISTORY_LEN events are kept so
+ * that subscribers can resume without missing any.
+ */
+type Bus struct {
+	mu      sync.Mutex
+	seq     uint64
+	history []Envelope
+	subs    map[*Subscription]struct{}
+	outputs map[c.OutPoint]output // Published, to resolve the spent ones
+	spends  map[c.TxId]spend      // Of the last SPENDS_LEN transactions
+	order   []c.TxId              // Of spends, oldest first
+	clock   util.Clock
+}
+
+// output is forgotten with the last transaction in spends spending it,
+// so that conflicting spends of it resolve as well
+type output struct {
+	address  c.Address
+	spenders int
+}
+
+// spend is what a transaction spends, kept for its later events
+type spend struct {
+	outPoints []c.OutPoint // In outputs
+	addresses []c.Address
+}
+
+func NewBus(clock util.Clock) *Bus {
+	return &Bus{
+		clock:   clock,
+		subs:    make(map[*Subscription]struct{}),
+		outputs: make(map[c.OutPoint]output),
+		spends:  make(map[c.TxId]spend)}
+}
+
+// Seq is the sequence number of the last event
+func (bus *Bus) Seq() uint64 {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	return bus.seq
+}
+
+// addresses lists the addresses paid or spent by txs. The first time a
+// transaction is seen, the outputs it spends are resolved and its own
+// outputs recorded.
+// Assume bus.mu is held
+func (bus *Bus) addresses(txs []Tx) []c.Address {
+	var addresses []c.Address
+	add := func(address c.Address) {
+		if !slices.Contains(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	for _, tx := range txs {
+		spent, ok := bus.spends[tx.TxId]
+		if !ok {
+			for _, txIn := range tx.TxData.TxIns {
+				if out, ok := bus.outputs[txIn.OutPoint]; ok {
+					out.spenders++
+					bus.outputs[txIn.OutPoint] = out
+					spent.outPoints = append(spent.outPoints, txIn.OutPoint)
+					spent.addresses = append(spent.addresses, out.address)
+				}
+			}
+			for i, txOut := range tx.TxData.TxOuts {
+				outPoint := c.OutPoint{TxId: tx.TxId, OutIdx: uint64(i)}
+				if _, ok := bus.outputs[outPoint]; !ok {
+					bus.outputs[outPoint] = output{address: txOut.Address}
+				}
+			}
+			bus.remember(tx.TxId, spent)
+		}
+		for _, address := range spent.addresses {
+			add(address)
+		}
+		for _, txOut := range tx.TxData.TxOuts {
+			add(txOut.Address)
+		}
+	}
+	return addresses
+}
+
+// remember keeps what txId spends, forgetting the oldest transaction
+// beyond SPENDS_LEN and the outputs no remaining one spends.
+// Assume bus.mu is held
+func (bus *Bus) remember(txId c.TxId, spent spend) {
+	if len(bus.order) == SPENDS_LEN {
+		for _, outPoint := range bus.spends[bus.order[0]].outPoints {
+			out := bus.outputs[outPoint]
+			if out.spenders--; out.spenders == 0 {
+				delete(bus.outputs, outPoint)
+			} else {
+				bus.outputs[outPoint] = out
+			}
+		}
+		delete(bus.spends, bus.order[0])
+		bus.order = slices.Delete(bus.order, 0, 1)
+	}
+	bus.spends[txId] = spent
+	bus.order = append(bus.order, txId)
+}
+
+// Publish assigns event the next sequence number, txs are the
+// transactions whose addresses the event is filtered by
+func (bus *Bus) Publish(event Event, txs ...Tx) uint64 {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	bus.seq++
+	envelope := Envelope{
+		Seq:       bus.seq,
+		Time:      bus.clock.Now(),
+		Kind:      event.Kind(),
+		Addresses: bus.addresses(txs),
+		Event:     event}
+	if e, ok := event.(WalletBalanceChanged); ok {
+		envelope.Addresses = append(envelope.Addresses, e.Address)
+	}
+	if len(bus.history) == HISTORY_LEN {
+		bus.history = slices.Delete(bus.history, 0, 1)
+	}
+	bus.history = append(bus.history, envelope)
+
+	for sub := range bus.subs {
+		if !sub.filter.Match(&envelope) {
+			continue
+		}
+		select {
+		case sub.c <- envelope:
+		default:
+			sub.lagged = true
+			delete(bus.subs, sub)
+			close(sub.c)
+		}
+	}
+	return envelope.Seq
+}
+
+// Subscribe delivers the events published from now on
+func (bus *Bus) Subscribe(filter Filter) *Subscription {
+	sub, _ := bus.Resume(filter, bus.Seq())
+	return sub
+}
+
+// Resume replays the kept events after seq, then delivers the events
+// published from now on. It fails if some of them are no longer kept.
+func (bus *Bus) Resume(filter Filter, seq uint64) (*Subscription, error) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if seq > bus.seq {
+		return nil, fmt.Errorf("seq %d is after the last event %d", seq, bus.seq)
+	}
+	i := len(bus.history) - int(bus.seq-seq)
+	if i < 0 {
+		return nil, fmt.Errorf("events after %d are no longer kept", seq)
+	}
+	var replay []Envelope
+	for _, envelope := range bus.history[i:] {
+		if filter.Match(&envelope) {
+			replay = append(replay, envelope)
+		}
+	}
+
+	ch := make(chan Envelope, len(replay)+SUBSCRIBER_BUFFER)
+	for _, envelope := range replay {
+		ch <- envelope
+	}
+	sub := &Subscription{C: ch, c: ch, filter: filter, bus: bus}
+	bus.subs[sub] = struct{}{}
+	return sub, nil
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gcoin/blockchain"
+	c "gcoin/currency"
+	"gcoin/mempool"
+	"gcoin/util"
+)
+
+func TestBus(t *testing.T) {
+	params := c.ActiveParams
+	defer func() { c.ActiveParams = params }()
+	c.ActiveParams.CoinbaseMaturity = 0
+
+	wallet1 := c.NewWallet()
+	wallet2 := c.NewWallet()
+	wallet3 := c.NewWallet()
+	chain := blockchain.NewChain([]c.BlockTransactions{
+		c.NewBlockTransactions([]c.RegularTransaction{}, wallet1.GetAddress(), 0, util.SystemClock{})}, util.SystemClock{})
+	utxoDb := c.NewUtxoDbFromChain(chain)
+	txn, err := wallet1.MakeRegularTransaction(&utxoDb, wallet2.GetAddress(), 5, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := NewBus(util.SystemClock{})
+	all := bus.Subscribe(Filter{})
+	only2 := bus.Subscribe(Filter{Addresses: []c.Address{wallet2.GetAddress()}})
+	only3 := bus.Subscribe(Filter{Addresses: []c.Address{wallet3.GetAddress()}})
+
+	bus.PublishBlockConnected(&chain[0])
+	bus.PublishNewTip(&chain[0])
+	pool := mempool.NewMempool(mempool.DEFAULT_MAX_SIZE, mempool.DEFAULT_EXPIRY, util.SystemClock{})
+	pool.Subscribe(bus)
+	if err := pool.Add(*txn, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+	pool.Remove(txn.TxId, mempool.REMOVED_EXPIRED)
+
+	kinds := func(sub *Subscription) []string {
+		var kinds []string
+		for len(sub.C) > 0 {
+			kinds = append(kinds, (<-sub.C).Kind)
+		}
+		return kinds
+	}
+	if got := kinds(all); strings.Join(got, ",") != "BlockConnected,NewTip,TxAcceptedToMempool,TxRemoved" {
+		t.Errorf("all %v", got)
+	}
+	if got := kinds(only2); strings.Join(got, ",") != "NewTip,TxAcceptedToMempool,TxRemoved" {
+		t.Errorf("only2 %v", got)
+	}
+	if got := kinds(only3); strings.Join(got, ",") != "NewTip" {
+		t.Errorf("only3 %v", got)
+	}
+
+	// The removal is found by the address spending to wallet2
+	sub, err := bus.Resume(Filter{Addresses: []c.Address{wallet1.GetAddress()}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope := <-sub.C; envelope.Seq != 3 {
+		t.Errorf("resumed at %d", envelope.Seq)
+	}
+	if removed := (<-sub.C).Event.(TxRemoved); removed.TxId != txn.TxId || removed.Reason != mempool.REMOVED_EXPIRED {
+		t.Errorf("removed %+v", removed)
+	}
+	if _, err := bus.Resume(Filter{}, 5); err == nil {
+		t.Error("resumed after the last event")
+	}
+
+	// A replacement spending the same outputs, without change,
+	// is found by the spending address too
+	replacement := wallet1.SignTxData(c.TxData{
+		TxIns:  txn.TxData.TxIns,
+		TxOuts: []c.TxOut{{Address: wallet3.GetAddress(), Amount: chain[0].Data.CTxn.Amount() - 2}}}, 2)
+	only1 := bus.Subscribe(Filter{Addresses: []c.Address{wallet1.GetAddress()}})
+	bus.Publish(TxAcceptedToMempool{TxId: replacement.TxId}, Tx{TxId: replacement.TxId, TxData: &replacement.TxData})
+	if got := kinds(only1); strings.Join(got, ",") != "TxAcceptedToMempool" {
+		t.Errorf("only1 %v", got)
+	}
+
+	// Spent outputs are forgotten with the last transaction spending them
+	for i := range SPENDS_LEN {
+		bus.Publish(NewTip{}, Tx{TxId: util.NewHash(i), TxData: &c.TxData{}})
+	}
+	if _, ok := bus.spends[txn.TxId]; ok || len(bus.spends) != SPENDS_LEN {
+		t.Errorf("%d spends kept", len(bus.spends))
+	}
+	for _, txIn := range txn.TxData.TxIns {
+		if _, ok := bus.outputs[txIn.OutPoint]; ok {
+			t.Errorf("spent %v kept", txIn.OutPoint)
+		}
+	}
+
+	// A subscriber that falls behind is dropped
+	for range SUBSCRIBER_BUFFER + 1 {
+		bus.PublishNewTip(&chain[0])
+	}
+	for range all.C {
+	}
+	if !all.Lagged() {
+		t.Error("not lagged")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	bus := NewBus(util.SystemClock{})
+	b := blockchain.NewChain([]c.BlockTransactions{
+		c.NewBlockTransactions([]c.RegularTransaction{}, c.Address{}, 0, util.SystemClock{})}, util.SystemClock{})[0]
+	bus.PublishBlockConnected(&b)
+	bus.PublishNewTip(&b)
+
+	server := httptest.NewServer(bus)
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	var lines []string
+	for len(lines) < 3 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || lines[0] != "id: 2" || lines[1] != "event: NewTip" || !strings.HasPrefix(lines[2], `data: {"Seq":2`) {
+		t.Errorf("lines %q", lines)
+	}
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	c "gcoin/currency"
+	"gcoin/mempool"
+	"gcoin/util"
+)
+
+// Event is one of the types below
+type Event interface {
+	Kind() string
+}
+
+type BlockConnected struct {
+	BlockHash util.Hash
+	Height    uint64
+	TxIds     []c.TxId // The coinbase first
+}
+
+type BlockDisconnected struct {
+	BlockHash util.Hash
+	Height    uint64
+	TxIds     []c.TxId
+}
+
+// NewTip follows the BlockConnected events of a new main chain
+type NewTip struct {
+	BlockHash util.Hash
+	Height    uint64
+	Diff      uint64
+}
+
+type TxAcceptedToMempool struct {
+	TxId c.TxId
+	Fee  uint64
+	Size int
+}
+
+type TxRemoved struct {
+	TxId   c.TxId
+	Reason mempool.RemovalReason
+}
+
+// WalletBalanceChanged reports the funds of Address in the main chain
+type WalletBalanceChanged struct {
+	Address  c.Address
+	Balance  uint64 // Mature
+	Immature uint64
+}
+
+func (BlockConnected) Kind() string       { return "BlockConnected" }
+func (BlockDisconnected) Kind() string    { return "BlockDisconnected" }
+func (NewTip) Kind() string               { return "NewTip" }
+func (TxAcceptedToMempool) Kind() string  { return "TxAcceptedToMempool" }
+func (TxRemoved) Kind() string            { return "TxRemoved" }
+func (WalletBalanceChanged) Kind() string { return "WalletBalanceChanged" }
+
+func txIds(b *c.Block) []c.TxId {
+	txIds := []c.TxId{b.Data.CTxn.TxId}
+	for _, txn := range b.Data.RTxns {
+		txIds = append(txIds, txn.TxId)
+	}
+	return txIds
+}
+
+func txs(b *c.Block) []Tx {
+	txs := []Tx{{TxId: b.Data.CTxn.TxId, TxData: &b.Data.CTxn.TxData}}
+	for i := range b.Data.RTxns {
+		txn := &b.Data.RTxns[i]
+		txs = append(txs, Tx{TxId: txn.TxId, TxData: &txn.TxData})
+	}
+	return txs
+}
+
+func (bus *Bus) PublishBlockConnected(b *c.Block) {
+	bus.Publish(BlockConnected{BlockHash: b.BlockHash, Height: b.BlockHeader.Index, TxIds: txIds(b)}, txs(b)...)
+}
+
+func (bus *Bus) PublishBlockDisconnected(b *c.Block) {
+	bus.Publish(BlockDisconnected{BlockHash: b.BlockHash, Height: b.BlockHeader.Index, TxIds: txIds(b)}, txs(b)...)
+}
+
+func (bus *Bus) PublishNewTip(b *c.Block) {
+	bus.Publish(NewTip{BlockHash: b.BlockHash, Height: b.BlockHeader.Index, Diff: b.BlockHeader.Diff})
+}
+
+// TransactionAccepted and TransactionRemoved implement mempool.Listener
+func (bus *Bus) TransactionAccepted(entry *mempool.Entry) {
+	txn := &entry.Txn
+	bus.Publish(TxAcceptedToMempool{TxId: txn.TxId, Fee: txn.TransactionFee, Size: entry.Size}, Tx{TxId: txn.TxId, TxData: &txn.TxData})
+}
+
+func (bus *Bus) TransactionRemoved(entry *mempool.Entry, reason mempool.RemovalReason) {
+	bus.Publish(TxRemoved{TxId: entry.Txn.TxId, Reason: reason}, Tx{TxId: entry.Txn.TxId, TxData: &entry.Txn.TxData})
+}
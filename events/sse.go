@@ -0,0 +1,75 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gcoin/util"
+)
+
+// ServeHTTP streams the events as Server-Sent Events. The query may
+// filter them by repeated address parameters, and resume after a
+// sequence number given by the after parameter or the Last-Event-ID
+// header. The stream ends if the client falls behind, to be resumed
+// from the last id received.
+func (bus *Bus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var filter Filter
+	query := r.URL.Query()
+	for _, s := range query["address"] {
+		var address util.Hash
+		if err := address.UnmarshalText([]byte(s)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Addresses = append(filter.Addresses, address)
+	}
+
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = query.Get("after")
+	}
+	var sub *Subscription
+	if after == "" {
+		sub = bus.Subscribe(filter)
+	} else {
+		seq, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if sub, err = bus.Resume(filter, seq); err != nil {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case envelope, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(envelope)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", envelope.Seq, envelope.Kind, data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
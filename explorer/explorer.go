@@ -0,0 +1,351 @@
+package explorer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	c "gcoin/currency"
+	"gcoin/index"
+	"gcoin/util"
+)
+
+const NUM_RECENT_BLOCKS = 20 // Blocks listed on the home page
+
+// Utxo is an unspent output of an address
+type Utxo struct {
+	OutPoint c.OutPoint
+	Entry    c.UtxoEntry
+	Mature   bool
+}
+
+// Backend is the node state the explorer reads.
+// Implementations must be safe for concurrent use.
+type Backend interface {
+	Chain() c.Chain
+	// Unspent returns the confirmed unspent outputs of address
+	Unspent(address c.Address) []Utxo
+	// History returns false if the address index is disabled
+	History(address c.Address) ([]index.AddrEvent, bool)
+	// LookupTransaction returns false if the transaction index is disabled or has no txId
+	LookupTransaction(txId c.TxId) (index.TxLocation, bool)
+}
+
+/*
+ * Explorer serves HTML pages for the chain of a node:
+ * - /                  recent blocks
+ * - /block/{id}        a block by height or hash
+ * - /tx/{txId}         a transaction with its inputs, outputs, fee and witness
+ * - /address/{address} balance, unspent outputs and history
+ * - /search?q=         redirects to one of the above
+ * Each page has a JSON counterpart under /api.
+ */
+type Explorer struct {
+	backend Backend
+	mux     *http.ServeMux
+}
+
+func NewExplorer(backend Backend) *Explorer {
+	explorer := &Explorer{backend: backend, mux: http.NewServeMux()}
+	explorer.handle("/{$}", "/api/blocks", "home", explorer.homePage)
+	explorer.handle("/block/{id}", "/api/block/{id}", "block", explorer.blockPage)
+	explorer.handle("/tx/{id}", "/api/tx/{id}", "tx", explorer.txPage)
+	explorer.handle("/address/{id}", "/api/address/{id}", "address", explorer.addressPage)
+	explorer.mux.HandleFunc("GET /search", explorer.search)
+	return explorer
+}
+
+func (explorer *Explorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	explorer.mux.ServeHTTP(w, r)
+}
+
+type notFoundError struct {
+	error
+}
+
+func notFound(format string, a ...any) error {
+	return notFoundError{fmt.Errorf(format, a...)}
+}
+
+// handle serves page at pattern as HTML and at apiPattern as JSON
+func (explorer *Explorer) handle(pattern string, apiPattern string, name string, page func(id string) (any, error)) {
+	serve := func(w http.ResponseWriter, r *http.Request, render func(data any) error) {
+		data, err := page(r.PathValue("id"))
+		if err != nil {
+			status := http.StatusBadRequest
+			if _, ok := err.(notFoundError); ok {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if err := render(data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+	explorer.mux.HandleFunc("GET "+pattern, func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, func(data any) error {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			return templates.ExecuteTemplate(w, name, data)
+		})
+	})
+	explorer.mux.HandleFunc("GET "+apiPattern, func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, func(data any) error {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "\t")
+			return enc.Encode(data)
+		})
+	})
+}
+
+func (explorer *Explorer) search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	target := "/"
+	if _, err := strconv.ParseUint(q, 10, 64); err == nil {
+		target = "/block/" + q
+	} else if hash, err := parseHash(q); err == nil {
+		chain := explorer.backend.Chain()
+		if _, ok := findBlock(chain, hash); ok {
+			target = "/block/" + q
+		} else if _, ok := explorer.findTransaction(chain, hash); ok {
+			target = "/tx/" + q
+		} else {
+			target = "/address/" + q
+		}
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func parseHash(s string) (util.Hash, error) {
+	var hash util.Hash
+	err := hash.UnmarshalText([]byte(s))
+	return hash, err
+}
+
+func findBlock(chain c.Chain, hash util.Hash) (*c.Block, bool) {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].BlockHash == hash {
+			return &chain[i], true
+		}
+	}
+	return nil, false
+}
+
+// txRef is a transaction found in the chain
+type txRef struct {
+	block    *c.Block
+	position int // As in index.TxLocation
+	txData   *c.TxData
+	txn      *c.RegularTransaction // nil for the coinbase
+}
+
+// findTransaction uses the transaction index if enabled, or scans the chain from the tip
+func (explorer *Explorer) findTransaction(chain c.Chain, txId c.TxId) (txRef, bool) {
+	at := func(b *c.Block, position int) txRef {
+		if position == 0 {
+			return txRef{block: b, txData: &b.Data.CTxn.TxData}
+		}
+		txn := &b.Data.RTxns[position-1]
+		return txRef{block: b, position: position, txData: &txn.TxData, txn: txn}
+	}
+	if location, ok := explorer.backend.LookupTransaction(txId); ok && location.Height < uint64(len(chain)) {
+		if b := &chain[location.Height]; b.BlockHash == location.BlockHash {
+			return at(b, location.Position), true
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		b := &chain[i]
+		if b.Data.CTxn.TxId == txId {
+			return at(b, 0), true
+		}
+		for j := range b.Data.RTxns {
+			if b.Data.RTxns[j].TxId == txId {
+				return at(b, j+1), true
+			}
+		}
+	}
+	return txRef{}, false
+}
+
+type BlockSummary struct {
+	Height    uint64
+	BlockHash util.Hash
+	Timestamp int64
+	Target    uint8
+	Diff      uint64
+	NumTxns   int
+	Size      int
+}
+
+func summarizeBlock(b *c.Block) BlockSummary {
+	return BlockSummary{
+		Height:    b.BlockHeader.Index,
+		BlockHash: b.BlockHash,
+		Timestamp: b.BlockHeader.Timestamp,
+		Target:    b.BlockHeader.Target,
+		Diff:      b.BlockHeader.Diff,
+		NumTxns:   1 + len(b.Data.RTxns),
+		Size:      b.Data.Size()}
+}
+
+type HomePage struct {
+	Height uint64 // Of the tip
+	Blocks []BlockSummary
+}
+
+func (explorer *Explorer) homePage(string) (any, error) {
+	chain := explorer.backend.Chain()
+	var page HomePage
+	if last := util.Last(chain); last != nil {
+		page.Height = last.BlockHeader.Index
+	}
+	for i := len(chain) - 1; i >= 0 && len(page.Blocks) < NUM_RECENT_BLOCKS; i-- {
+		page.Blocks = append(page.Blocks, summarizeBlock(&chain[i]))
+	}
+	return page, nil
+}
+
+type TxSummary struct {
+	TxId     c.TxId
+	Coinbase bool
+	Amount   uint64 // Sum of the outputs
+	Fee      uint64
+}
+
+type BlockPage struct {
+	BlockSummary
+	PrevHash  util.Hash
+	InnerHash util.Hash
+	Nonce     uint64
+	Txns      []TxSummary
+}
+
+func amount(txData *c.TxData) uint64 {
+	var sum uint64
+	for _, txOut := range txData.TxOuts {
+		sum += txOut.Amount
+	}
+	return sum
+}
+
+func (explorer *Explorer) blockPage(id string) (any, error) {
+	chain := explorer.backend.Chain()
+	var b *c.Block
+	if height, err := strconv.ParseUint(id, 10, 64); err == nil {
+		if height >= uint64(len(chain)) {
+			return nil, notFound("height %d not found", height)
+		}
+		b = &chain[height]
+	} else if hash, err := parseHash(id); err == nil {
+		var ok bool
+		if b, ok = findBlock(chain, hash); !ok {
+			return nil, notFound("block %s not found", hash)
+		}
+	} else {
+		return nil, fmt.Errorf("%q is neither a height nor a hash", id)
+	}
+
+	bh := &b.BlockHeader
+	page := BlockPage{
+		BlockSummary: summarizeBlock(b),
+		PrevHash:     bh.PrevHash,
+		InnerHash:    bh.InnerHash,
+		Nonce:        bh.Nonce}
+	ctxn := &b.Data.CTxn
+	page.Txns = append(page.Txns, TxSummary{TxId: ctxn.TxId, Coinbase: true, Amount: ctxn.Amount()})
+	for _, txn := range b.Data.RTxns {
+		page.Txns = append(page.Txns, TxSummary{TxId: txn.TxId, Amount: amount(&txn.TxData), Fee: txn.TransactionFee})
+	}
+	return page, nil
+}
+
+type TxInput struct {
+	OutPoint c.OutPoint
+	Sequence uint64
+	TxOut    *c.TxOut // nil if the funding transaction is not found
+}
+
+type TxPage struct {
+	TxId       c.TxId
+	BlockHash  util.Hash
+	Height     uint64
+	Position   int
+	Coinbase   bool
+	Timestamp  int64
+	LockTime   uint64
+	Inputs     []TxInput
+	Outputs    []c.TxOut
+	Fee        uint64
+	Size       int
+	WitnessPub string
+	WitnessSig string
+}
+
+func (explorer *Explorer) txPage(id string) (any, error) {
+	txId, err := parseHash(id)
+	if err != nil {
+		return nil, err
+	}
+	chain := explorer.backend.Chain()
+	ref, ok := explorer.findTransaction(chain, txId)
+	if !ok {
+		return nil, notFound("txId %s not found", txId)
+	}
+
+	page := TxPage{
+		TxId:      txId,
+		BlockHash: ref.block.BlockHash,
+		Height:    ref.block.BlockHeader.Index,
+		Position:  ref.position,
+		Coinbase:  ref.txn == nil,
+		Timestamp: ref.txData.Timestamp,
+		LockTime:  ref.txData.LockTime,
+		Outputs:   ref.txData.TxOuts}
+	for _, txIn := range ref.txData.TxIns {
+		input := TxInput{OutPoint: txIn.OutPoint, Sequence: txIn.Sequence}
+		if funding, ok := explorer.findTransaction(chain[:page.Height+1], txIn.TxId); ok {
+			if txOuts := funding.txData.TxOuts; txIn.OutIdx < uint64(len(txOuts)) {
+				input.TxOut = &txOuts[txIn.OutIdx]
+			}
+		}
+		page.Inputs = append(page.Inputs, input)
+	}
+	if ref.txn != nil {
+		page.Fee = ref.txn.TransactionFee
+		page.Size = ref.txn.Size()
+		page.WitnessPub = hex.EncodeToString(ref.txn.Witness.GetPub())
+		page.WitnessSig = hex.EncodeToString(ref.txn.Witness.GetSig())
+	} else {
+		page.Size = ref.block.Data.CTxn.Size()
+	}
+	return page, nil
+}
+
+type AddressPage struct {
+	Address        c.Address
+	Balance        uint64
+	Immature       uint64
+	Utxos          []Utxo
+	HistoryEnabled bool
+	History        []index.AddrEvent
+}
+
+func (explorer *Explorer) addressPage(id string) (any, error) {
+	address, err := parseHash(id)
+	if err != nil {
+		return nil, err
+	}
+	page := AddressPage{Address: address, Utxos: explorer.backend.Unspent(address)}
+	for _, utxo := range page.Utxos {
+		if utxo.Mature {
+			page.Balance += utxo.Entry.TxOut.Amount
+		} else {
+			page.Immature += utxo.Entry.TxOut.Amount
+		}
+	}
+	page.History, page.HistoryEnabled = explorer.backend.History(address)
+	return page, nil
+}
@@ -0,0 +1,114 @@
+package explorer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gcoin/blockchain"
+	c "gcoin/currency"
+	"gcoin/index"
+	"gcoin/util"
+)
+
+// backend serves a fixed chain without indexes
+type backend struct {
+	chain  c.Chain
+	utxoDb c.UtxoDb
+}
+
+func (b *backend) Chain() c.Chain {
+	return b.chain
+}
+
+func (b *backend) Unspent(address c.Address) []Utxo {
+	var utxos []Utxo
+	for _, outPoint := range b.utxoDb.OutPoints(address) {
+		entry, _ := b.utxoDb.Entry(outPoint)
+		utxos = append(utxos, Utxo{OutPoint: outPoint, Entry: entry, Mature: b.utxoDb.IsMature(entry)})
+	}
+	return utxos
+}
+
+func (b *backend) History(c.Address) ([]index.AddrEvent, bool) {
+	return nil, false
+}
+
+func (b *backend) LookupTransaction(c.TxId) (index.TxLocation, bool) {
+	return index.TxLocation{}, false
+}
+
+func get(t *testing.T, handler http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestExplorer(t *testing.T) {
+	params := c.ActiveParams
+	defer func() { c.ActiveParams = params }()
+	c.ActiveParams.CoinbaseMaturity = 0
+
+	wallet1 := c.NewWallet()
+	wallet2 := c.NewWallet()
+	chain := blockchain.NewChain([]c.BlockTransactions{
+		c.NewBlockTransactions([]c.RegularTransaction{}, wallet1.GetAddress(), 0, util.SystemClock{})}, util.SystemClock{})
+	utxoDb := c.NewUtxoDbFromChain(chain)
+	txn, err := wallet1.MakeRegularTransaction(&utxoDb, wallet2.GetAddress(), 5, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := chain.NextUnmintedBlock(c.NewBlockTransactions([]c.RegularTransaction{*txn}, wallet2.GetAddress(), 1, util.SystemClock{}), util.SystemClock{})
+	chain = append(chain, b)
+	utxoDb.UpdateFromBlock(&b)
+	explorer := NewExplorer(&backend{chain: chain, utxoDb: utxoDb})
+
+	for _, path := range []string{"/", "/api/blocks", "/block/1", "/block/" + b.BlockHash.String(), "/tx/" + txn.TxId.String(),
+		"/address/" + wallet2.GetAddress().String()} {
+		if rec := get(t, explorer, path); rec.Code != http.StatusOK {
+			t.Errorf("%s: %d %s", path, rec.Code, rec.Body)
+		}
+	}
+	if rec := get(t, explorer, "/block/2"); rec.Code != http.StatusNotFound {
+		t.Errorf("code %d", rec.Code)
+	}
+
+	var txPage TxPage
+	rec := get(t, explorer, "/api/tx/"+txn.TxId.String())
+	if err := json.Unmarshal(rec.Body.Bytes(), &txPage); err != nil {
+		t.Fatal(err)
+	}
+	if txPage.Height != 1 || txPage.Position != 1 || txPage.Fee != 1 || len(txPage.Inputs) != 1 {
+		t.Errorf("txPage %+v", txPage)
+	}
+	// The input is the genesis coinbase
+	if input := txPage.Inputs[0].TxOut; input == nil || input.Address != wallet1.GetAddress() {
+		t.Errorf("input %+v", input)
+	}
+
+	var addressPage AddressPage
+	rec = get(t, explorer, "/api/address/"+wallet2.GetAddress().String())
+	if err := json.Unmarshal(rec.Body.Bytes(), &addressPage); err != nil {
+		t.Fatal(err)
+	}
+	if addressPage.Balance != 5+c.Subsidy(1)+1 || len(addressPage.Utxos) != 2 || addressPage.HistoryEnabled {
+		t.Errorf("addressPage %+v", addressPage)
+	}
+
+	searches := map[string]string{
+		"1":                           "/block/1",
+		b.BlockHash.String():          "/block/",
+		txn.TxId.String():             "/tx/",
+		wallet1.GetAddress().String(): "/address/",
+		"not a hash":                  "/",
+	}
+	for q, prefix := range searches {
+		rec := get(t, explorer, "/search?q="+strings.ReplaceAll(q, " ", "+"))
+		if location := rec.Header().Get("Location"); rec.Code != http.StatusSeeOther || !strings.HasPrefix(location, prefix) {
+			t.Errorf("search %q: %d %s", q, rec.Code, location)
+		}
+	}
+}
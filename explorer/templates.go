@@ -0,0 +1,140 @@
+package explorer
+
+import (
+	"html/template"
+	"time"
+)
+
+var funcs = template.FuncMap{
+	"time": func(millis int64) string {
+		return time.UnixMilli(millis).UTC().Format(time.DateTime)
+	},
+}
+
+var templates = template.Must(template.New("").Funcs(funcs).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gcoin explorer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+.hash { font-family: monospace; }
+</style>
+</head>
+<body>
+<p><a href="/">gcoin</a>
+<form action="/search" style="display:inline">
+<input name="q" size="70" placeholder="height, block hash, txId or address">
+<input type="submit" value="Search">
+</form></p>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "home"}}{{template "header"}}
+<h2>Blocks up to height {{.Height}}</h2>
+<table>
+<tr><th>Height</th><th>Hash</th><th>Time</th><th>Transactions</th><th>Size</th></tr>
+{{range .Blocks}}<tr>
+<td><a href="/block/{{.Height}}">{{.Height}}</a></td>
+<td class="hash"><a href="/block/{{.BlockHash}}">{{.BlockHash}}</a></td>
+<td>{{time .Timestamp}}</td>
+<td>{{.NumTxns}}</td>
+<td>{{.Size}}</td>
+</tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+
+{{define "block"}}{{template "header"}}
+<h2>Block {{.Height}}</h2>
+<table>
+<tr><th>Hash</th><td class="hash">{{.BlockHash}}</td></tr>
+<tr><th>Previous</th><td class="hash">{{if .Height}}<a href="/block/{{.PrevHash}}">{{.PrevHash}}</a>{{else}}{{.PrevHash}}{{end}}</td></tr>
+<tr><th>Inner hash</th><td class="hash">{{.InnerHash}}</td></tr>
+<tr><th>Time</th><td>{{time .Timestamp}}</td></tr>
+<tr><th>Target</th><td>{{.Target}}</td></tr>
+<tr><th>Diff</th><td>{{.Diff}}</td></tr>
+<tr><th>Nonce</th><td>{{.Nonce}}</td></tr>
+<tr><th>Size</th><td>{{.Size}}</td></tr>
+</table>
+<h3>Transactions</h3>
+<table>
+<tr><th>TxId</th><th>Amount</th><th>Fee</th></tr>
+{{range .Txns}}<tr>
+<td class="hash"><a href="/tx/{{.TxId}}">{{.TxId}}</a>{{if .Coinbase}} (coinbase){{end}}</td>
+<td>{{.Amount}}</td>
+<td>{{.Fee}}</td>
+</tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+
+{{define "tx"}}{{template "header"}}
+<h2>Transaction</h2>
+<table>
+<tr><th>TxId</th><td class="hash">{{.TxId}}</td></tr>
+<tr><th>Block</th><td class="hash"><a href="/block/{{.BlockHash}}">{{.BlockHash}}</a> at height {{.Height}}, position {{.Position}}</td></tr>
+<tr><th>Time</th><td>{{time .Timestamp}}</td></tr>
+<tr><th>Lock time</th><td>{{.LockTime}}</td></tr>
+<tr><th>Fee</th><td>{{.Fee}}</td></tr>
+<tr><th>Size</th><td>{{.Size}}</td></tr>
+</table>
+{{if .Coinbase}}<p>Coinbase, no inputs</p>{{else}}
+<h3>Inputs</h3>
+<table>
+<tr><th>OutPoint</th><th>Sequence</th><th>Address</th><th>Amount</th></tr>
+{{range .Inputs}}<tr>
+<td class="hash"><a href="/tx/{{.OutPoint.TxId}}">{{.OutPoint.TxId}}</a>:{{.OutPoint.OutIdx}}</td>
+<td>{{.Sequence}}</td>
+{{with .TxOut}}<td class="hash"><a href="/address/{{.Address}}">{{.Address}}</a></td><td>{{.Amount}}</td>{{else}}<td></td><td>unknown</td>{{end}}
+</tr>{{end}}
+</table>{{end}}
+<h3>Outputs</h3>
+<table>
+<tr><th>Index</th><th>Address</th><th>Amount</th></tr>
+{{range $i, $txOut := .Outputs}}<tr>
+<td>{{$i}}</td>
+<td class="hash"><a href="/address/{{$txOut.Address}}">{{$txOut.Address}}</a></td>
+<td>{{$txOut.Amount}}</td>
+</tr>{{end}}
+</table>
+{{if not .Coinbase}}<h3>Witness</h3>
+<table>
+<tr><th>Public key</th><td class="hash">{{.WitnessPub}}</td></tr>
+<tr><th>Signature</th><td class="hash">{{.WitnessSig}}</td></tr>
+</table>{{end}}
+{{template "footer"}}{{end}}
+
+{{define "address"}}{{template "header"}}
+<h2>Address</h2>
+<p class="hash">{{.Address}}</p>
+<table>
+<tr><th>Balance</th><td>{{.Balance}}</td></tr>
+<tr><th>Immature</th><td>{{.Immature}}</td></tr>
+</table>
+<h3>Unspent outputs</h3>
+<table>
+<tr><th>OutPoint</th><th>Height</th><th>Amount</th><th>Mature</th></tr>
+{{range .Utxos}}<tr>
+<td class="hash"><a href="/tx/{{.OutPoint.TxId}}">{{.OutPoint.TxId}}</a>:{{.OutPoint.OutIdx}}</td>
+<td>{{.Entry.Height}}</td>
+<td>{{.Entry.TxOut.Amount}}</td>
+<td>{{.Mature}}</td>
+</tr>{{end}}
+</table>
+<h3>History</h3>
+{{if .HistoryEnabled}}<table>
+<tr><th>Height</th><th>TxId</th><th>OutPoint</th><th>Amount</th></tr>
+{{range .History}}<tr>
+<td><a href="/block/{{.BlockHash}}">{{.Height}}</a></td>
+<td class="hash"><a href="/tx/{{.TxId}}">{{.TxId}}</a></td>
+<td class="hash">{{.OutPoint.TxId}}:{{.OutPoint.OutIdx}}</td>
+<td>{{if .Spending}}-{{else}}+{{end}}{{.Amount}}</td>
+</tr>{{end}}
+</table>{{else}}<p>Address index disabled, run the node with -index</p>{{end}}
+{{template "footer"}}{{end}}
+`))
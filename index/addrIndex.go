@@ -0,0 +1,88 @@
+package index
+
+import (
+	"slices"
+
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+// AddrEvent is an output paid to an address or spent from it
+type AddrEvent struct {
+	OutPoint  c.OutPoint
+	Amount    uint64
+	Spending  bool   // Whether OutPoint is spent by TxId rather than created
+	TxId      c.TxId // Transaction creating or spending OutPoint
+	BlockHash util.Hash
+	Height    uint64
+}
+
+// AddrIndex lists the funding and spending events of every address
+// in the main chain, in chain order
+type AddrIndex struct {
+	events  map[c.Address][]AddrEvent
+	outputs map[c.OutPoint]c.TxOut // Every output ever created, spent or not
+}
+
+func NewAddrIndex() AddrIndex {
+	return AddrIndex{
+		events:  make(map[c.Address][]AddrEvent),
+		outputs: make(map[c.OutPoint]c.TxOut)}
+}
+
+func (index *AddrIndex) ConnectBlock(b *c.Block) {
+	height := b.BlockHeader.Index
+	forEachTxData(&b.Data, func(_ int, txId c.TxId, txData *c.TxData) {
+		for _, txIn := range txData.TxIns {
+			txOut, ok := index.outputs[txIn.OutPoint]
+			if !ok {
+				continue
+			}
+			event := AddrEvent{OutPoint: txIn.OutPoint, Amount: txOut.Amount, Spending: true, TxId: txId, BlockHash: b.BlockHash, Height: height}
+			index.events[txOut.Address] = append(index.events[txOut.Address], event)
+		}
+		for i, txOut := range txData.TxOuts {
+			outPoint := c.OutPoint{TxId: txId, OutIdx: uint64(i)}
+			index.outputs[outPoint] = txOut
+			event := AddrEvent{OutPoint: outPoint, Amount: txOut.Amount, TxId: txId, BlockHash: b.BlockHash, Height: height}
+			index.events[txOut.Address] = append(index.events[txOut.Address], event)
+		}
+	})
+}
+
+func (index *AddrIndex) DisconnectBlock(b *c.Block) {
+	forEachTxData(&b.Data, func(_ int, txId c.TxId, txData *c.TxData) {
+		addresses := make([]c.Address, 0, len(txData.TxIns)+len(txData.TxOuts))
+		for _, txIn := range txData.TxIns {
+			if txOut, ok := index.outputs[txIn.OutPoint]; ok {
+				addresses = append(addresses, txOut.Address)
+			}
+		}
+		for i, txOut := range txData.TxOuts {
+			delete(index.outputs, c.OutPoint{TxId: txId, OutIdx: uint64(i)})
+			addresses = append(addresses, txOut.Address)
+		}
+		for _, address := range addresses {
+			index.popEvents(address, b.BlockHash)
+		}
+	})
+}
+
+// popEvents drops the events of blockHash, which are the latest of address
+func (index *AddrIndex) popEvents(address c.Address, blockHash util.Hash) {
+	events := index.events[address]
+	n := len(events)
+	for n > 0 && events[n-1].BlockHash == blockHash {
+		n--
+	}
+	if n == 0 {
+		delete(index.events, address)
+	} else {
+		index.events[address] = events[:n]
+	}
+}
+
+// History returns the events of address in chain order
+func (index *AddrIndex) History(address c.Address) []AddrEvent {
+	return slices.Clone(index.events[address])
+}
@@ -0,0 +1,19 @@
+package index
+
+import c "gcoin/currency"
+
+// Indexer follows the main chain as blocks are connected and disconnected.
+// Blocks are disconnected from the tip, in the reverse order of connection.
+type Indexer interface {
+	ConnectBlock(b *c.Block)
+	DisconnectBlock(b *c.Block)
+}
+
+// forEachTxData visits the coinbase of bt at position 0, then its regular transactions
+func forEachTxData(bt *c.BlockTransactions, f func(position int, txId c.TxId, txData *c.TxData)) {
+	f(0, bt.CTxn.TxId, &bt.CTxn.TxData)
+	for i := range bt.RTxns {
+		txn := &bt.RTxns[i]
+		f(i+1, txn.TxId, &txn.TxData)
+	}
+}
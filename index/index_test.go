@@ -0,0 +1,61 @@
+package index
+
+import (
+	"testing"
+
+	"gcoin/blockchain"
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+func TestIndexers(t *testing.T) {
+	params := c.ActiveParams
+	defer func() { c.ActiveParams = params }()
+	c.ActiveParams.CoinbaseMaturity = 0
+
+	wallet1 := c.NewWallet()
+	wallet2 := c.NewWallet()
+	chain := blockchain.NewChain([]c.BlockTransactions{
+		c.NewBlockTransactions([]c.RegularTransaction{}, wallet1.GetAddress(), 0, util.SystemClock{})}, util.SystemClock{})
+	utxoDb := c.NewUtxoDbFromChain(chain)
+
+	txn, err := wallet1.MakeRegularTransaction(&utxoDb, wallet2.GetAddress(), 5, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := chain.NextUnmintedBlock(c.NewBlockTransactions([]c.RegularTransaction{*txn}, wallet2.GetAddress(), 1, util.SystemClock{}), util.SystemClock{})
+	chain = append(chain, b)
+
+	txIndex := NewTxIndex()
+	addrIndex := NewAddrIndex()
+	for _, indexer := range []Indexer{&txIndex, &addrIndex} {
+		for i := range chain {
+			indexer.ConnectBlock(&chain[i])
+		}
+	}
+
+	if location, ok := txIndex.Lookup(txn.TxId); !ok || location.BlockHash != b.BlockHash || location.Position != 1 {
+		t.Errorf("location %+v", location)
+	}
+	// Funded by the genesis coinbase, then spent
+	if history := addrIndex.History(wallet1.GetAddress()); len(history) != 3 || !history[1].Spending || history[1].TxId != txn.TxId {
+		t.Errorf("history %+v", history)
+	}
+	// Funded by txn and by the coinbase of b
+	if history := addrIndex.History(wallet2.GetAddress()); len(history) != 2 {
+		t.Errorf("history %+v", history)
+	}
+
+	// b is reorged away
+	txIndex.DisconnectBlock(&b)
+	addrIndex.DisconnectBlock(&b)
+	if _, ok := txIndex.Lookup(txn.TxId); ok {
+		t.Error("txn still indexed")
+	}
+	if history := addrIndex.History(wallet1.GetAddress()); len(history) != 1 || history[0].Spending {
+		t.Errorf("history %+v", history)
+	}
+	if history := addrIndex.History(wallet2.GetAddress()); len(history) != 0 {
+		t.Errorf("history %+v", history)
+	}
+}
@@ -0,0 +1,40 @@
+package index
+
+import (
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+type TxLocation struct {
+	BlockHash util.Hash
+	Height    uint64
+	Position  int // 0 for the coinbase, i+1 for RTxns[i]
+}
+
+// TxIndex finds the block of the main chain containing a transaction
+type TxIndex struct {
+	locations map[c.TxId]TxLocation
+}
+
+func NewTxIndex() TxIndex {
+	return TxIndex{locations: make(map[c.TxId]TxLocation)}
+}
+
+func (index *TxIndex) ConnectBlock(b *c.Block) {
+	forEachTxData(&b.Data, func(position int, txId c.TxId, _ *c.TxData) {
+		index.locations[txId] = TxLocation{BlockHash: b.BlockHash, Height: b.BlockHeader.Index, Position: position}
+	})
+}
+
+func (index *TxIndex) DisconnectBlock(b *c.Block) {
+	forEachTxData(&b.Data, func(_ int, txId c.TxId, _ *c.TxData) {
+		if location, ok := index.locations[txId]; ok && location.BlockHash == b.BlockHash {
+			delete(index.locations, txId)
+		}
+	})
+}
+
+func (index *TxIndex) Lookup(txId c.TxId) (TxLocation, bool) {
+	location, ok := index.locations[txId]
+	return location, ok
+}
@@ -0,0 +1,110 @@
+package mempool
+
+import (
+	"fmt"
+	"math/bits"
+
+	c "gcoin/currency"
+)
+
+const MAX_CONFIRM_TARGET = 25      // Max blocks an estimate can be asked for
+const FEE_ESTIMATE_DECAY = 0.95    // Weight kept by past data points on every block
+const FEE_ESTIMATE_SUCCESS = 0.85  // Fraction of transactions confirmed within target
+const FEE_ESTIMATE_MIN_SAMPLES = 1 // Decayed number of transactions a bucket needs
+
+// feeBucket holds the decayed counts of transactions whose fee rate is
+// in [1 << (i - 1), 1 << i) for bucket i, and 0 for bucket 0
+type feeBucket struct {
+	total     float64
+	confirmed [MAX_CONFIRM_TARGET + 1]float64 // Confirmed within that many blocks
+}
+
+type pendingTxn struct {
+	bucket int
+	height uint64
+}
+
+/*
+ * FeeEstimator learns how long transactions took to confirm at each fee rate.
+ *
+ * A transaction is tracked from the height it enters the mempool to the
+ * block that confirms it. Transactions dropped from the mempool count as
+ * never confirmed. Older data points decay so that estimates follow the
+ * recent blocks.
+ */
+type FeeEstimator struct {
+	pending map[c.TxId]pendingTxn
+	buckets [65]feeBucket
+}
+
+func NewFeeEstimator() FeeEstimator {
+	return FeeEstimator{pending: make(map[c.TxId]pendingTxn)}
+}
+
+func feeBucketIndex(feeRate uint64) int {
+	return bits.Len64(feeRate)
+}
+
+func (est *FeeEstimator) TransactionAccepted(entry *Entry) {
+	est.pending[entry.Txn.TxId] = pendingTxn{bucket: feeBucketIndex(entry.FeeRate()), height: entry.Height}
+}
+
+// TransactionRemoved records that txId has left the mempool unconfirmed
+func (est *FeeEstimator) TransactionRemoved(txId c.TxId) {
+	if p, ok := est.pending[txId]; ok {
+		delete(est.pending, txId)
+		est.buckets[p.bucket].total++
+	}
+}
+
+func (est *FeeEstimator) BlockConnected(bt *c.BlockTransactions) {
+	for i := range est.buckets {
+		bucket := &est.buckets[i]
+		bucket.total *= FEE_ESTIMATE_DECAY
+		for j := range bucket.confirmed {
+			bucket.confirmed[j] *= FEE_ESTIMATE_DECAY
+		}
+	}
+	for _, txn := range bt.RTxns {
+		p, ok := est.pending[txn.TxId]
+		if !ok {
+			continue
+		}
+		delete(est.pending, txn.TxId)
+		bucket := &est.buckets[p.bucket]
+		bucket.total++
+		blocks := bt.Height - min(p.height, bt.Height) + 1
+		for j := blocks; j <= MAX_CONFIRM_TARGET; j++ {
+			bucket.confirmed[j]++
+		}
+	}
+}
+
+// EstimateFeeRate returns the lowest fee rate at which transactions,
+// and those paying more, confirmed within target blocks often enough
+func (est *FeeEstimator) EstimateFeeRate(target uint64) (uint64, error) {
+	if target == 0 || target > MAX_CONFIRM_TARGET {
+		return 0, fmt.Errorf("target %d not in [1, %d]", target, MAX_CONFIRM_TARGET)
+	}
+	found := false
+	var feeRate uint64
+	for i := len(est.buckets) - 1; i >= 0; i-- {
+		bucket := &est.buckets[i]
+		if bucket.total < FEE_ESTIMATE_MIN_SAMPLES {
+			continue
+		}
+		if bucket.confirmed[target] < FEE_ESTIMATE_SUCCESS*bucket.total {
+			break
+		}
+		found = true
+		if i > 0 {
+			feeRate = 1 << (i - 1)
+		} else {
+			feeRate = 0
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("not enough data for target %d", target)
+	}
+	return feeRate, nil
+}
@@ -0,0 +1,42 @@
+package mempool
+
+import (
+	"testing"
+
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+func TestEstimateFeeRate(t *testing.T) {
+	est := NewFeeEstimator()
+	if _, err := est.EstimateFeeRate(1); err == nil {
+		t.Error("estimate without data")
+	}
+
+	// Fee rates of 64 confirm in the next block, fee rates of 16 in
+	// the one after and fee rates of 4 never
+	for height := range uint64(20) {
+		var next []c.RegularTransaction
+		for i, fee := range []uint64{64, 16, 4} {
+			txn := c.RegularTransaction{TransactionFee: fee, TxId: util.NewHash([]uint64{height, uint64(i)})}
+			est.TransactionAccepted(&Entry{Txn: txn, Size: c.FEE_RATE_SCALE, Height: height})
+			if fee == 4 {
+				est.TransactionRemoved(txn.TxId)
+			} else {
+				next = append(next, txn)
+			}
+		}
+		est.BlockConnected(&c.BlockTransactions{Height: height, RTxns: next[:1]})
+		est.BlockConnected(&c.BlockTransactions{Height: height + 1, RTxns: next[1:]})
+	}
+
+	if feeRate, err := est.EstimateFeeRate(1); err != nil || feeRate != 64 {
+		t.Errorf("EstimateFeeRate(1) == %d, %v", feeRate, err)
+	}
+	if feeRate, err := est.EstimateFeeRate(2); err != nil || feeRate != 16 {
+		t.Errorf("EstimateFeeRate(2) == %d, %v", feeRate, err)
+	}
+	if _, err := est.EstimateFeeRate(MAX_CONFIRM_TARGET + 1); err == nil {
+		t.Error("target out of range")
+	}
+}
@@ -0,0 +1,417 @@
+package mempool
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+const DEFAULT_MAX_SIZE = 1 << 20        // Bytes of transactions kept before evicting
+const DEFAULT_EXPIRY = 10 * time.Minute // Age at which transactions are dropped
+const MAX_REPLACEMENTS = 100            // Max transactions evicted by one replacement
+const MAX_ANCESTORS = 25                // Max unconfirmed ancestors of a transaction, itself included
+const MAX_DESCENDANTS = 25              // Max unconfirmed descendants of a transaction, itself included
+
+type Entry struct {
+	Txn    c.RegularTransaction
+	Size   int
+	Time   int64  // When the transaction is accepted
+	Height uint64 // Height of the next block when the transaction is accepted
+	seq    uint64 // Arrival order
+}
+
+func (entry *Entry) FeeRate() uint64 {
+	return c.FeeRate(entry.Txn.TransactionFee, entry.Size)
+}
+
+// RemovalReason tells why a transaction left the pool
+type RemovalReason string
+
+const (
+	REMOVED_CONFIRMED RemovalReason = "confirmed" // Included in a block
+	REMOVED_CONFLICT  RemovalReason = "conflict"  // Spends the outpoints spent by a block
+	REMOVED_REPLACED  RemovalReason = "replaced"  // Replaced by a higher fee spend
+	REMOVED_EVICTED   RemovalReason = "evicted"   // Lowest fee rate of a full pool
+	REMOVED_EXPIRED   RemovalReason = "expired"   // Older than the expiry
+	REMOVED_INVALID   RemovalReason = "invalid"   // No longer valid after a reorg
+)
+
+// Listener is notified of the transactions entering and leaving a Mempool.
+// It is called while the pool is being modified and must not call back into it.
+type Listener interface {
+	TransactionAccepted(entry *Entry)
+	TransactionRemoved(entry *Entry, reason RemovalReason)
+}
+
+/*
+ * Mempool holds the validated transactions waiting for a block.
+ *
+ * Transactions are indexed by TxId and by the outpoints they spend,
+ * so that conflicting spends are detected on arrival and when a block
+ * spends the same outpoints. The pool is bounded in bytes and evicts
+ * the entries with the lowest fee rate once full.
+ *
+ * A transaction may spend the outputs of others in the pool, forming
+ * chains of ancestors and descendants bounded by MAX_ANCESTORS and
+ * MAX_DESCENDANTS. Removing a transaction for any reason other than
+ * confirmation also removes its descendants.
+ */
+type Mempool struct {
+	entries   map[c.TxId]*Entry
+	spent     map[c.OutPoint]c.TxId // OutPoint -> TxId of the spender
+	size      int
+	maxSize   int
+	expiry    time.Duration
+	seq       uint64
+	est       FeeEstimator
+	listeners []Listener
+	clock     util.Clock
+}
+
+func NewMempool(maxSize int, expiry time.Duration, clock util.Clock) Mempool {
+	return Mempool{
+		clock:   clock,
+		entries: make(map[c.TxId]*Entry),
+		spent:   make(map[c.OutPoint]c.TxId),
+		maxSize: maxSize,
+		expiry:  expiry,
+		est:     NewFeeEstimator()}
+}
+
+func (pool *Mempool) Subscribe(listener Listener) {
+	pool.listeners = append(pool.listeners, listener)
+}
+
+func (pool *Mempool) Len() int {
+	return len(pool.entries)
+}
+
+// Size is the sum of the sizes of all transactions
+func (pool *Mempool) Size() int {
+	return pool.size
+}
+
+func (pool *Mempool) Has(txId c.TxId) bool {
+	_, ok := pool.entries[txId]
+	return ok
+}
+
+func (pool *Mempool) Get(txId c.TxId) (*Entry, bool) {
+	entry, ok := pool.entries[txId]
+	return entry, ok
+}
+
+func (pool *Mempool) Transaction(txId c.TxId) (*c.RegularTransaction, bool) {
+	if entry, ok := pool.entries[txId]; ok {
+		return &entry.Txn, true
+	}
+	return nil, false
+}
+
+// Conflicts returns the TxIds of the transactions spending any outpoint spent by txData
+func (pool *Mempool) Conflicts(txData *c.TxData) []c.TxId {
+	var txIds []c.TxId
+	for _, txIn := range txData.TxIns {
+		if txId, ok := pool.spent[txIn.OutPoint]; ok && !slices.Contains(txIds, txId) {
+			txIds = append(txIds, txId)
+		}
+	}
+	return txIds
+}
+
+// Descendants returns the TxIds of the transactions spending the outputs of
+// txIds, directly or not, including txIds themselves
+func (pool *Mempool) Descendants(txIds []c.TxId) []c.TxId {
+	seen := make(map[c.TxId]struct{})
+	var descendants []c.TxId
+	for len(txIds) > 0 {
+		txId := txIds[0]
+		txIds = txIds[1:]
+		entry, ok := pool.entries[txId]
+		if _, dup := seen[txId]; dup || !ok {
+			continue
+		}
+		seen[txId] = struct{}{}
+		descendants = append(descendants, txId)
+		for i := range entry.Txn.TxData.TxOuts {
+			outPoint := c.OutPoint{TxId: txId, OutIdx: uint64(i)}
+			if child, ok := pool.spent[outPoint]; ok {
+				txIds = append(txIds, child)
+			}
+		}
+	}
+	return descendants
+}
+
+// Entries are returned in arrival order
+func (pool *Mempool) Entries() []*Entry {
+	entries := make([]*Entry, 0, len(pool.entries))
+	for _, entry := range pool.entries {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a *Entry, b *Entry) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return entries
+}
+
+// Transactions are returned in arrival order
+func (pool *Mempool) Transactions() []c.RegularTransaction {
+	entries := pool.Entries()
+	txns := make([]c.RegularTransaction, len(entries))
+	for i, entry := range entries {
+		txns[i] = entry.Txn
+	}
+	return txns
+}
+
+// Add validates txn against utxoDb and the transactions already in the pool.
+// A txn spending the same outpoints as others in the pool replaces them,
+// and their descendants, if it passes ValidateReplacement.
+// Assume txn.Validate() == nil
+func (pool *Mempool) Add(txn c.RegularTransaction, utxoDb *c.UtxoDb) error {
+	if pool.Has(txn.TxId) {
+		return fmt.Errorf("duplicate found")
+	}
+	conflicts := pool.Conflicts(&txn.TxData)
+	view := pool.viewWithout(utxoDb, pool.Descendants(conflicts))
+	if err := c.ValidateRegularTransaction(view, &txn); err != nil {
+		return err
+	}
+	if err := pool.ValidateChainLimits(&txn.TxData); err != nil {
+		return err
+	}
+	var replaced []c.TxId
+	if len(conflicts) != 0 {
+		var err error
+		if replaced, err = pool.ValidateReplacement(&txn, conflicts); err != nil {
+			return err
+		}
+	}
+
+	entry := &Entry{
+		Txn:    txn,
+		Size:   txn.Size(),
+		Time:   pool.clock.Now(),
+		Height: utxoDb.Height()}
+	// Checked first, so a replacement that does not fit keeps the originals
+	if pool.wouldEvict(entry, replaced) {
+		return fmt.Errorf("mempool full")
+	}
+	pool.RemoveWithDescendants(replaced, REMOVED_REPLACED)
+	pool.insert(entry)
+	pool.evict()
+	return nil
+}
+
+// Ancestors returns the TxIds of the transactions in the pool whose outputs
+// txData spends, directly or not
+func (pool *Mempool) Ancestors(txData *c.TxData) []c.TxId {
+	seen := make(map[c.TxId]struct{})
+	var ancestors []c.TxId
+	txIns := slices.Clone(txData.TxIns)
+	for len(txIns) > 0 {
+		txId := txIns[0].TxId
+		txIns = txIns[1:]
+		entry, ok := pool.entries[txId]
+		if _, dup := seen[txId]; dup || !ok {
+			continue
+		}
+		seen[txId] = struct{}{}
+		ancestors = append(ancestors, txId)
+		txIns = append(txIns, entry.Txn.TxData.TxIns...)
+	}
+	return ancestors
+}
+
+// ValidateChainLimits checks that adding txData keeps every chain of
+// unconfirmed transactions within MAX_ANCESTORS and MAX_DESCENDANTS
+func (pool *Mempool) ValidateChainLimits(txData *c.TxData) error {
+	ancestors := pool.Ancestors(txData)
+	if len(ancestors)+1 > MAX_ANCESTORS {
+		return fmt.Errorf("%d ancestors exceed %d", len(ancestors)+1, MAX_ANCESTORS)
+	}
+	for _, txId := range ancestors {
+		if n := len(pool.Descendants([]c.TxId{txId})) + 1; n > MAX_DESCENDANTS {
+			return fmt.Errorf("%d descendants of %s exceed %d", n, txId, MAX_DESCENDANTS)
+		}
+	}
+	return nil
+}
+
+// Revalidate drops the transactions that no longer validate against utxoDb,
+// such as those spending the outputs of transactions lost in a reorg
+func (pool *Mempool) Revalidate(utxoDb *c.UtxoDb) []c.TxId {
+	var invalid []c.TxId
+	for _, entry := range pool.Entries() {
+		view := pool.viewWithout(utxoDb, []c.TxId{entry.Txn.TxId})
+		if err := c.ValidateRegularTransaction(view, &entry.Txn); err != nil {
+			invalid = append(invalid, entry.Txn.TxId)
+		}
+	}
+	return pool.RemoveWithDescendants(invalid, REMOVED_INVALID)
+}
+
+// ValidateReplacement checks that txn pays for replacing conflicts by:
+// 1. Evicting at most MAX_REPLACEMENTS transactions with their descendants
+// 2. Paying a higher fee rate than every transaction in conflicts
+// 3. Paying a higher absolute fee than all evicted transactions together
+// It returns the TxIds to be evicted
+func (pool *Mempool) ValidateReplacement(txn *c.RegularTransaction, conflicts []c.TxId) ([]c.TxId, error) {
+	replaced := pool.Descendants(conflicts)
+	if len(replaced) > MAX_REPLACEMENTS {
+		return nil, fmt.Errorf("replaces %d > %d transactions", len(replaced), MAX_REPLACEMENTS)
+	}
+	feeRate := txn.FeeRate()
+	for _, txId := range conflicts {
+		if entry := pool.entries[txId]; feeRate <= entry.FeeRate() {
+			return nil, fmt.Errorf("fee rate %d not above %d of %s", feeRate, entry.FeeRate(), txId)
+		}
+	}
+	var fees uint64
+	for _, txId := range replaced {
+		fees += pool.entries[txId].Txn.TransactionFee
+	}
+	if txn.TransactionFee <= fees {
+		return nil, fmt.Errorf("fee %d not above %d of replaced", txn.TransactionFee, fees)
+	}
+	return replaced, nil
+}
+
+func (pool *Mempool) insert(entry *Entry) {
+	pool.seq++
+	entry.seq = pool.seq
+	txn := &entry.Txn
+	pool.entries[txn.TxId] = entry
+	for _, txIn := range txn.TxData.TxIns {
+		pool.spent[txIn.OutPoint] = txn.TxId
+	}
+	pool.size += entry.Size
+	pool.est.TransactionAccepted(entry)
+	for _, listener := range pool.listeners {
+		listener.TransactionAccepted(entry)
+	}
+}
+
+// Remove drops txId from the pool, returns false if it is not found
+func (pool *Mempool) Remove(txId c.TxId, reason RemovalReason) bool {
+	entry, ok := pool.entries[txId]
+	if !ok {
+		return false
+	}
+	delete(pool.entries, txId)
+	for _, txIn := range entry.Txn.TxData.TxIns {
+		if pool.spent[txIn.OutPoint] == txId {
+			delete(pool.spent, txIn.OutPoint)
+		}
+	}
+	pool.size -= entry.Size
+	pool.est.TransactionRemoved(txId)
+	for _, listener := range pool.listeners {
+		listener.TransactionRemoved(entry, reason)
+	}
+	return true
+}
+
+// RemoveWithDescendants drops txIds and every transaction spending their outputs
+func (pool *Mempool) RemoveWithDescendants(txIds []c.TxId, reason RemovalReason) []c.TxId {
+	removed := pool.Descendants(txIds)
+	for _, txId := range removed {
+		pool.Remove(txId, reason)
+	}
+	return removed
+}
+
+// evict drops the lowest fee rate entries, the latest first, until the pool fits
+func (pool *Mempool) evict() {
+	for pool.size > pool.maxSize {
+		var worst *Entry
+		for _, entry := range pool.entries {
+			if worst == nil || entry.FeeRate() < worst.FeeRate() ||
+				(entry.FeeRate() == worst.FeeRate() && entry.seq > worst.seq) {
+				worst = entry
+			}
+		}
+		pool.RemoveWithDescendants([]c.TxId{worst.Txn.TxId}, REMOVED_EVICTED)
+	}
+}
+
+// wouldEvict reports whether evict would drop entry, the latest to arrive,
+// once replaced are removed and entry inserted
+func (pool *Mempool) wouldEvict(entry *Entry, replaced []c.TxId) bool {
+	removed := make(map[c.TxId]struct{})
+	size := pool.size + entry.Size
+	for _, txId := range replaced {
+		removed[txId] = struct{}{}
+		size -= pool.entries[txId].Size
+	}
+	ancestors := pool.Ancestors(&entry.Txn.TxData)
+	for size > pool.maxSize {
+		worst := entry
+		for txId, other := range pool.entries {
+			if _, ok := removed[txId]; !ok && (other.FeeRate() < worst.FeeRate() ||
+				(other.FeeRate() == worst.FeeRate() && other.seq > worst.seq && worst != entry)) {
+				worst = other
+			}
+		}
+		// Evicting an ancestor drops entry with the descendants
+		if worst == entry || slices.Contains(ancestors, worst.Txn.TxId) {
+			return true
+		}
+		for _, txId := range pool.Descendants([]c.TxId{worst.Txn.TxId}) {
+			if _, ok := removed[txId]; !ok {
+				removed[txId] = struct{}{}
+				size -= pool.entries[txId].Size
+			}
+		}
+	}
+	return false
+}
+
+// Expire drops the entries accepted before now - expiry
+func (pool *Mempool) Expire(now int64) []c.TxId {
+	var expired []*Entry
+	for _, entry := range pool.entries {
+		if entry.Time+pool.expiry.Milliseconds() < now {
+			expired = append(expired, entry)
+		}
+	}
+	// In the order of acceptance, for the removals to be reproducible
+	slices.SortFunc(expired, func(a *Entry, b *Entry) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	var txIds []c.TxId
+	for _, entry := range expired {
+		txIds = append(txIds, entry.Txn.TxId)
+	}
+	return pool.RemoveWithDescendants(txIds, REMOVED_EXPIRED)
+}
+
+// ConnectBlock drops the transactions confirmed by bt and those
+// spending the same outpoints as them, with their descendants
+func (pool *Mempool) ConnectBlock(bt *c.BlockTransactions) {
+	pool.est.BlockConnected(bt)
+	for _, txn := range bt.RTxns {
+		pool.Remove(txn.TxId, REMOVED_CONFIRMED)
+		pool.RemoveWithDescendants(pool.Conflicts(&txn.TxData), REMOVED_CONFLICT)
+	}
+}
+
+// EstimateFeeRate is the fee rate needed to confirm within target blocks
+// according to the transactions this pool has seen confirmed
+func (pool *Mempool) EstimateFeeRate(target uint64) (uint64, error) {
+	return pool.est.EstimateFeeRate(target)
+}
+
+// DisconnectBlock re-admits the transactions of bt that are still valid
+// against utxoDb, the UTXO set of the new tip. Call Revalidate once all
+// blocks are disconnected.
+func (pool *Mempool) DisconnectBlock(bt *c.BlockTransactions, utxoDb *c.UtxoDb) {
+	for _, txn := range bt.RTxns {
+		pool.Add(txn, utxoDb)
+	}
+}
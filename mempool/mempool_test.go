@@ -0,0 +1,328 @@
+package mempool
+
+import (
+	"testing"
+
+	"gcoin/blockchain"
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+// newFundedUtxoDb pays each wallet a spendable coinbase output
+func newFundedUtxoDb(t *testing.T, wallets ...*c.Wallet) (c.Chain, c.UtxoDb) {
+	params := c.ActiveParams
+	t.Cleanup(func() { c.ActiveParams = params })
+	c.ActiveParams.CoinbaseMaturity = 0
+
+	var s []c.BlockTransactions
+	for i, wallet := range wallets {
+		s = append(s, c.NewBlockTransactions([]c.RegularTransaction{}, wallet.GetAddress(), uint64(i), util.SystemClock{}))
+	}
+	chain := blockchain.NewChain(s, util.SystemClock{})
+	return chain, c.NewUtxoDbFromChain(chain)
+}
+
+func makeTransaction(t *testing.T, wallet *c.Wallet, utxoDb *c.UtxoDb, amount uint64, fee uint64) c.RegularTransaction {
+	txn, err := wallet.MakeRegularTransaction(utxoDb, util.Hash{}, amount, fee, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *txn
+}
+
+func TestAddConflicts(t *testing.T) {
+	wallet := c.NewWallet()
+	_, utxoDb := newFundedUtxoDb(t, &wallet)
+	pool := NewMempool(DEFAULT_MAX_SIZE, DEFAULT_EXPIRY, util.SystemClock{})
+
+	txn1 := makeTransaction(t, &wallet, &utxoDb, 1, 1)
+	txn2 := makeTransaction(t, &wallet, &utxoDb, 2, 1)
+	if err := pool.Add(txn1, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(txn1, &utxoDb); err == nil {
+		t.Error("duplicate accepted")
+	}
+	if err := pool.Add(txn2, &utxoDb); err == nil {
+		t.Error("conflict accepted")
+	}
+	if pool.Len() != 1 || pool.Size() != txn1.Size() {
+		t.Errorf("len %d size %d", pool.Len(), pool.Size())
+	}
+}
+
+func TestEvict(t *testing.T) {
+	wallet1 := c.NewWallet()
+	wallet2 := c.NewWallet()
+	_, utxoDb := newFundedUtxoDb(t, &wallet1, &wallet2)
+
+	txn1 := makeTransaction(t, &wallet1, &utxoDb, 1, 1)
+	txn2 := makeTransaction(t, &wallet2, &utxoDb, 1, 2)
+	pool := NewMempool(txn1.Size()+txn2.Size()-1, DEFAULT_EXPIRY, util.SystemClock{})
+	if err := pool.Add(txn1, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(txn2, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Has(txn1.TxId) || !pool.Has(txn2.TxId) {
+		t.Error("lowest fee rate is not evicted")
+	}
+	if err := pool.Add(txn1, &utxoDb); err == nil {
+		t.Error("lowest fee rate accepted when full")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	wallet := c.NewWallet()
+	_, utxoDb := newFundedUtxoDb(t, &wallet)
+	pool := NewMempool(DEFAULT_MAX_SIZE, DEFAULT_EXPIRY, util.SystemClock{})
+
+	txn := makeTransaction(t, &wallet, &utxoDb, 1, 1)
+	if err := pool.Add(txn, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := pool.Get(txn.TxId)
+	if txIds := pool.Expire(entry.Time); len(txIds) != 0 {
+		t.Error("expired too early")
+	}
+	if txIds := pool.Expire(entry.Time + DEFAULT_EXPIRY.Milliseconds() + 1); len(txIds) != 1 || pool.Len() != 0 {
+		t.Error("not expired")
+	}
+}
+
+func TestConnectDisconnectBlock(t *testing.T) {
+	wallet := c.NewWallet()
+	chain, utxoDb := newFundedUtxoDb(t, &wallet)
+	pool := NewMempool(DEFAULT_MAX_SIZE, DEFAULT_EXPIRY, util.SystemClock{})
+
+	txn1 := makeTransaction(t, &wallet, &utxoDb, 1, 1)
+	txn2 := makeTransaction(t, &wallet, &utxoDb, 2, 1)
+	if err := pool.Add(txn2, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+
+	// A block confirms a conflicting spend
+	bt := c.NewBlockTransactions([]c.RegularTransaction{txn1}, util.Hash{}, utxoDb.Height(), util.SystemClock{})
+	b := chain.NextUnmintedBlock(bt, util.SystemClock{})
+	if err := utxoDb.ConnectBlock(&b); err != nil {
+		t.Fatal(err)
+	}
+	pool.ConnectBlock(&b.Data)
+	if pool.Len() != 0 {
+		t.Error("conflict not dropped")
+	}
+
+	// The block is reorged away
+	utxoDb = c.NewUtxoDbFromChain(chain)
+	pool.DisconnectBlock(&b.Data, &utxoDb)
+	if !pool.Has(txn1.TxId) {
+		t.Error("not re-admitted")
+	}
+}
+
+func TestReplaceByFee(t *testing.T) {
+	wallet := c.NewWallet()
+	_, utxoDb := newFundedUtxoDb(t, &wallet)
+	pool := NewMempool(DEFAULT_MAX_SIZE, DEFAULT_EXPIRY, util.SystemClock{})
+
+	txn := makeTransaction(t, &wallet, &utxoDb, 1, 1)
+	if err := pool.Add(txn, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.BumpFee(&utxoDb, &pool, txn.TxId, 1, util.SystemClock{}); err == nil {
+		t.Error("same fee accepted")
+	}
+
+	bumped, err := wallet.BumpFee(&utxoDb, &pool, txn.TxId, 3, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(*bumped, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Has(txn.TxId) || !pool.Has(bumped.TxId) || pool.Len() != 1 {
+		t.Error("not replaced")
+	}
+	if err := pool.Add(txn, &utxoDb); err == nil {
+		t.Error("replaced by lower fee")
+	}
+
+	// A replacement evicted as soon as inserted keeps the original
+	wallet2 := c.NewWallet()
+	_, utxoDb2 := newFundedUtxoDb(t, &wallet2)
+	rich := makeTransaction(t, &wallet2, &utxoDb2, 1, 40)
+	if err := pool.Add(rich, &utxoDb2); err != nil {
+		t.Fatal(err)
+	}
+	rebumped, err := wallet.BumpFee(&utxoDb, &pool, bumped.TxId, 5, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.maxSize = rich.Size() + rebumped.Size() - 1
+	if err := pool.Add(*rebumped, &utxoDb); err == nil {
+		t.Error("evicted replacement accepted")
+	}
+	if !pool.Has(bumped.TxId) || !pool.Has(rich.TxId) || pool.Has(rebumped.TxId) {
+		t.Error("original lost to an evicted replacement")
+	}
+}
+
+func TestSpendUnconfirmed(t *testing.T) {
+	wallet1 := c.NewWallet()
+	wallet2 := c.NewWallet()
+	chain, utxoDb := newFundedUtxoDb(t, &wallet1)
+	pool := NewMempool(DEFAULT_MAX_SIZE, DEFAULT_EXPIRY, util.SystemClock{})
+
+	parent, err := wallet1.MakeRegularTransaction(&utxoDb, wallet2.GetAddress(), 10, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(*parent, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both the payment and the change are spendable through the view
+	view := pool.View(&utxoDb)
+	if funds, _ := wallet2.AvailableFunds(view); funds != 10 {
+		t.Errorf("funds %d", funds)
+	}
+	if _, err := wallet2.MakeRegularTransaction(&utxoDb, wallet1.GetAddress(), 5, 1, util.SystemClock{}); err == nil {
+		t.Error("unconfirmed payment spent from the confirmed set")
+	}
+	if _, err := wallet2.MakeRegularTransaction(view, wallet1.GetAddress(), 5, 1, util.SystemClock{}); err != nil {
+		t.Error(err)
+	}
+	child, err := wallet1.MakeRegularTransaction(view, wallet2.GetAddress(), 1, 1, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(*child, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+	if ancestors := pool.Ancestors(&child.TxData); len(ancestors) != 1 || ancestors[0] != parent.TxId {
+		t.Errorf("ancestors %v", ancestors)
+	}
+
+	// Confirming the parent keeps the child
+	bt := c.NewBlockTransactions([]c.RegularTransaction{*parent}, util.Hash{}, utxoDb.Height(), util.SystemClock{})
+	b := chain.NextUnmintedBlock(bt, util.SystemClock{})
+	if err := utxoDb.ConnectBlock(&b); err != nil {
+		t.Fatal(err)
+	}
+	pool.ConnectBlock(&b.Data)
+	if pool.Len() != 1 || !pool.Has(child.TxId) {
+		t.Error("child dropped")
+	}
+	if invalid := pool.Revalidate(&utxoDb); len(invalid) != 0 {
+		t.Errorf("invalid %v", invalid)
+	}
+
+	// A reorg re-admits the parent after the child, whose inputs stay spent
+	utxoDb = c.NewUtxoDbFromChain(chain)
+	pool.DisconnectBlock(&b.Data, &utxoDb)
+	if pool.Len() != 2 || !pool.Has(parent.TxId) {
+		t.Fatal("parent not re-admitted")
+	}
+	view = pool.View(&utxoDb)
+	for _, txIn := range child.TxData.TxIns {
+		if _, ok := view.Entry(txIn.OutPoint); ok {
+			t.Errorf("%v spent by the child unspent in the view", txIn.OutPoint)
+		}
+	}
+	var change uint64
+	for _, txOut := range child.TxData.TxOuts {
+		if txOut.Address == wallet1.GetAddress() {
+			change += txOut.Amount
+		}
+	}
+	if funds, _ := wallet1.AvailableFunds(view); funds != change {
+		t.Errorf("funds %d, change %d", funds, change)
+	}
+
+	// The view follows the pool as it changes
+	pool.Remove(child.TxId, REMOVED_EXPIRED)
+	for _, txIn := range child.TxData.TxIns {
+		if _, ok := view.Entry(txIn.OutPoint); !ok {
+			t.Errorf("%v spent by the removed child hidden in the view", txIn.OutPoint)
+		}
+	}
+}
+
+func TestChainLimits(t *testing.T) {
+	wallet := c.NewWallet()
+	_, utxoDb := newFundedUtxoDb(t, &wallet)
+	pool := NewMempool(DEFAULT_MAX_SIZE, DEFAULT_EXPIRY, util.SystemClock{})
+
+	for i := range MAX_ANCESTORS + 1 {
+		txn, err := wallet.MakeRegularTransaction(pool.View(&utxoDb), util.Hash{}, 1, 0, util.SystemClock{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = pool.Add(*txn, &utxoDb)
+		if i < MAX_ANCESTORS && err != nil {
+			t.Fatal(err)
+		}
+		if i == MAX_ANCESTORS && err == nil {
+			t.Error("chain limit ignored")
+		}
+	}
+}
+
+// recorder collects the notifications of a Mempool
+type recorder struct {
+	accepted []c.TxId
+	removed  map[c.TxId]RemovalReason
+}
+
+func (rec *recorder) TransactionAccepted(entry *Entry) {
+	rec.accepted = append(rec.accepted, entry.Txn.TxId)
+}
+
+func (rec *recorder) TransactionRemoved(entry *Entry, reason RemovalReason) {
+	rec.removed[entry.Txn.TxId] = reason
+}
+
+func TestListener(t *testing.T) {
+	wallet1 := c.NewWallet()
+	wallet2 := c.NewWallet()
+	chain, utxoDb := newFundedUtxoDb(t, &wallet1, &wallet2)
+	pool := NewMempool(DEFAULT_MAX_SIZE, DEFAULT_EXPIRY, util.SystemClock{})
+	rec := recorder{removed: make(map[c.TxId]RemovalReason)}
+	pool.Subscribe(&rec)
+
+	txn1 := makeTransaction(t, &wallet1, &utxoDb, 1, 1)
+	txn2 := makeTransaction(t, &wallet2, &utxoDb, 1, 1)
+	for _, txn := range []c.RegularTransaction{txn1, txn2} {
+		if err := pool.Add(txn, &utxoDb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bumped, err := wallet1.BumpFee(&utxoDb, &pool, txn1.TxId, 3, util.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(*bumped, &utxoDb); err != nil {
+		t.Fatal(err)
+	}
+
+	b := chain.NextUnmintedBlock(c.NewBlockTransactions([]c.RegularTransaction{txn2}, util.Hash{}, utxoDb.Height(), util.SystemClock{}), util.SystemClock{})
+	if err := utxoDb.ConnectBlock(&b); err != nil {
+		t.Fatal(err)
+	}
+	pool.ConnectBlock(&b.Data)
+	pool.Expire(pool.entries[bumped.TxId].Time + DEFAULT_EXPIRY.Milliseconds() + 1)
+
+	if len(rec.accepted) != 3 {
+		t.Errorf("accepted %v", rec.accepted)
+	}
+	want := map[c.TxId]RemovalReason{
+		txn1.TxId:   REMOVED_REPLACED,
+		txn2.TxId:   REMOVED_CONFIRMED,
+		bumped.TxId: REMOVED_EXPIRED}
+	for txId, reason := range want {
+		if rec.removed[txId] != reason {
+			t.Errorf("%s removed %q, want %q", txId, rec.removed[txId], reason)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package mempool
+
+import (
+	"slices"
+
+	c "gcoin/currency"
+)
+
+// View layers the outputs of the transactions in the pool over a confirmed
+// UtxoView. Outputs spent by the pool are hidden. Unconfirmed outputs are
+// reported at the height of the next block.
+func (pool *Mempool) View(base c.UtxoView) c.UtxoView {
+	return pool.viewWithout(base, nil)
+}
+
+// viewWithout is View as if txIds were not in the pool
+func (pool *Mempool) viewWithout(base c.UtxoView, txIds []c.TxId) *poolView {
+	excluded := make(map[c.TxId]struct{}, len(txIds))
+	for _, txId := range txIds {
+		excluded[txId] = struct{}{}
+	}
+	return &poolView{pool: pool, base: base, excluded: excluded}
+}
+
+/*
+ * poolView is the UtxoView returned by View.
+ *
+ * The pool already indexes its transactions by TxId and the outpoints
+ * they spend, and keeps both up to date on every insert and removal,
+ * so the view reads them directly instead of replaying the pool. The
+ * outputs a transaction creates or spends do not depend on the others,
+ * so the order transactions arrived in does not matter.
+ */
+type poolView struct {
+	pool     *Mempool
+	base     c.UtxoView
+	excluded map[c.TxId]struct{}
+}
+
+func (view *poolView) Height() uint64 {
+	return view.base.Height()
+}
+
+func (view *poolView) MedianTime() int64 {
+	return view.base.MedianTime()
+}
+
+// has reports whether txId is in the pool and not excluded
+func (view *poolView) has(txId c.TxId) bool {
+	_, excluded := view.excluded[txId]
+	return !excluded && view.pool.Has(txId)
+}
+
+// spent reports whether a transaction of the view spends outPoint
+func (view *poolView) spent(outPoint c.OutPoint) bool {
+	txId, ok := view.pool.spent[outPoint]
+	return ok && view.has(txId)
+}
+
+func (view *poolView) Entry(outPoint c.OutPoint) (c.UtxoEntry, bool) {
+	if view.spent(outPoint) {
+		return c.UtxoEntry{}, false
+	}
+	if view.has(outPoint.TxId) {
+		txOuts := view.pool.entries[outPoint.TxId].Txn.TxData.TxOuts
+		if outPoint.OutIdx >= uint64(len(txOuts)) {
+			return c.UtxoEntry{}, false
+		}
+		return c.UtxoEntry{TxOut: txOuts[outPoint.OutIdx], Height: view.Height()}, true
+	}
+	return view.base.Entry(outPoint)
+}
+
+func (view *poolView) OutPoints(address c.Address) []c.OutPoint {
+	var outPoints []c.OutPoint
+	for _, outPoint := range view.base.OutPoints(address) {
+		if !view.spent(outPoint) {
+			outPoints = append(outPoints, outPoint)
+		}
+	}
+	for txId, entry := range view.pool.entries {
+		if !view.has(txId) {
+			continue
+		}
+		for i, txOut := range entry.Txn.TxData.TxOuts {
+			outPoint := c.OutPoint{TxId: txId, OutIdx: uint64(i)}
+			if txOut.Address == address && !view.spent(outPoint) {
+				outPoints = append(outPoints, outPoint)
+			}
+		}
+	}
+	slices.SortFunc(outPoints, c.CompareOutPoints)
+	return outPoints
+}
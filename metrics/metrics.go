@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+type metric interface {
+	typeName() string
+	write(w io.Writer, name string)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter only goes up
+type Counter struct {
+	v atomic.Uint64
+}
+
+func (counter *Counter) Inc() {
+	counter.v.Add(1)
+}
+
+func (counter *Counter) Add(n uint64) {
+	counter.v.Add(n)
+}
+
+func (counter *Counter) Value() uint64 {
+	return counter.v.Load()
+}
+
+func (counter *Counter) typeName() string {
+	return "counter"
+}
+
+func (counter *Counter) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, counter.Value())
+}
+
+// Gauge goes up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (gauge *Gauge) Set(v float64) {
+	gauge.bits.Store(math.Float64bits(v))
+}
+
+func (gauge *Gauge) Value() float64 {
+	return math.Float64frombits(gauge.bits.Load())
+}
+
+func (gauge *Gauge) typeName() string {
+	return "gauge"
+}
+
+func (gauge *Gauge) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(gauge.Value()))
+}
+
+// gaugeFunc is a gauge read when scraped
+type gaugeFunc func() float64
+
+func (f gaugeFunc) typeName() string {
+	return "gauge"
+}
+
+func (f gaugeFunc) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(f()))
+}
+
+// CounterVec is a family of counters partitioned by the value of one label
+type CounterVec struct {
+	label    string
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for value, creating it on first use
+func (vec *CounterVec) With(value string) *Counter {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+
+	counter, ok := vec.counters[value]
+	if !ok {
+		counter = &Counter{}
+		vec.counters[value] = counter
+	}
+	return counter
+}
+
+func (vec *CounterVec) typeName() string {
+	return "counter"
+}
+
+func (vec *CounterVec) write(w io.Writer, name string) {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+
+	values := make([]string, 0, len(vec.counters))
+	for value := range vec.counters {
+		values = append(values, value)
+	}
+	slices.Sort(values)
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, vec.label, value, vec.counters[value].Value())
+	}
+}
+
+// Histogram counts observations in cumulative buckets of upper bounds
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64 // Ascending, without +Inf
+	counts []uint64  // counts[i] observations <= bounds[i], the last for +Inf
+	sum    float64
+}
+
+func (histogram *Histogram) Observe(v float64) {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+
+	i, _ := slices.BinarySearch(histogram.bounds, v)
+	histogram.counts[i]++
+	histogram.sum += v
+}
+
+func (histogram *Histogram) typeName() string {
+	return "histogram"
+}
+
+func (histogram *Histogram) write(w io.Writer, name string) {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+
+	var count uint64
+	for i, n := range histogram.counts {
+		count += n
+		bound := math.Inf(1)
+		if i < len(histogram.bounds) {
+			bound = histogram.bounds[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, formatFloat(bound), count)
+	}
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(histogram.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+type family struct {
+	name   string
+	help   string
+	metric metric
+}
+
+/*
+ * Registry holds named metrics and writes them in the Prometheus text
+ * exposition format, in registration order. Metrics are safe for
+ * concurrent use and are updated without holding the registry.
+ */
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (registry *Registry) register(name string, help string, m metric) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for _, f := range registry.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metric %s already registered", name))
+		}
+	}
+	registry.families = append(registry.families, family{name: name, help: help, metric: m})
+}
+
+func (registry *Registry) NewCounter(name string, help string) *Counter {
+	counter := &Counter{}
+	registry.register(name, help, counter)
+	return counter
+}
+
+func (registry *Registry) NewGauge(name string, help string) *Gauge {
+	gauge := &Gauge{}
+	registry.register(name, help, gauge)
+	return gauge
+}
+
+// NewGaugeFunc registers a gauge whose value is f() at every scrape
+func (registry *Registry) NewGaugeFunc(name string, help string, f func() float64) {
+	registry.register(name, help, gaugeFunc(f))
+}
+
+func (registry *Registry) NewCounterVec(name string, help string, label string) *CounterVec {
+	vec := &CounterVec{label: label, counters: make(map[string]*Counter)}
+	registry.register(name, help, vec)
+	return vec
+}
+
+// NewHistogram panics unless bounds are ascending
+func (registry *Registry) NewHistogram(name string, help string, bounds []float64) *Histogram {
+	if !slices.IsSorted(bounds) {
+		panic(fmt.Sprintf("bounds of %s not ascending", name))
+	}
+	histogram := &Histogram{bounds: slices.Clone(bounds), counts: make([]uint64, len(bounds)+1)}
+	registry.register(name, help, histogram)
+	return histogram
+}
+
+func (registry *Registry) WriteTo(w io.Writer) (int64, error) {
+	registry.mu.Lock()
+	families := slices.Clone(registry.families)
+	registry.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, f := range families {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", f.name, f.metric.typeName())
+		f.metric.write(&buf, f.name)
+	}
+	return buf.WriteTo(w)
+}
+
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	registry.WriteTo(w)
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("blocks_total", "Blocks seen")
+	gauge := registry.NewGauge("hash_rate", "Hashes per second")
+	registry.NewGaugeFunc("height", "Tip height", func() float64 { return 7 })
+	vec := registry.NewCounterVec("messages_total", "Messages by type", "type")
+	histogram := registry.NewHistogram("depth", "Reorg depth", []float64{1, 2, 4})
+
+	counter.Inc()
+	counter.Add(2)
+	gauge.Set(1.5)
+	vec.With("tx").Inc()
+	vec.With("block").Add(3)
+	for _, v := range []float64{1, 3, 3, 10} {
+		histogram.Observe(v)
+	}
+
+	var sb strings.Builder
+	if _, err := registry.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP blocks_total Blocks seen
+# TYPE blocks_total counter
+blocks_total 3
+# HELP hash_rate Hashes per second
+# TYPE hash_rate gauge
+hash_rate 1.5
+# HELP height Tip height
+# TYPE height gauge
+height 7
+# HELP messages_total Messages by type
+# TYPE messages_total counter
+messages_total{type="block"} 3
+messages_total{type="tx"} 1
+# HELP depth Reorg depth
+# TYPE depth histogram
+depth_bucket{le="1"} 1
+depth_bucket{le="2"} 1
+depth_bucket{le="4"} 3
+depth_bucket{le="+Inf"} 4
+depth_sum 17
+depth_count 4
+`
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic")
+		}
+	}()
+	registry := NewRegistry()
+	registry.NewCounter("a", "")
+	registry.NewGauge("a", "")
+}
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Request is a JSON-RPC 2.0 request
+type Request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Id      json.RawMessage `json:"id,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Response is a JSON-RPC 2.0 response
+type Response struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id,omitempty"`
+}
+
+const (
+	PARSE_ERROR      = -32700
+	METHOD_NOT_FOUND = -32601
+	INVALID_PARAMS   = -32602
+	INTERNAL_ERROR   = -32603
+)
+
+type handler func(params json.RawMessage) (any, *Error)
+
+// Server dispatches JSON-RPC requests posted over HTTP to registered methods
+type Server struct {
+	mu      sync.RWMutex
+	methods map[string]handler
+}
+
+func NewServer() *Server {
+	return &Server{methods: make(map[string]handler)}
+}
+
+// Register exposes f as method. Its params are decoded from the JSON object
+// of the request and its result is encoded as JSON.
+func Register[P any, R any](server *Server, method string, f func(P) (R, error)) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.methods[method] = func(raw json.RawMessage) (any, *Error) {
+		var params P
+		if len(raw) != 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, &Error{Code: INVALID_PARAMS, Message: err.Error()}
+			}
+		}
+		result, err := f(params)
+		if err != nil {
+			return nil, &Error{Code: INTERNAL_ERROR, Message: err.Error()}
+		}
+		return result, nil
+	}
+}
+
+func (server *Server) Call(req *Request) Response {
+	resp := Response{JsonRpc: "2.0", Id: req.Id}
+	server.mu.RLock()
+	h, ok := server.methods[req.Method]
+	server.mu.RUnlock()
+	if !ok {
+		resp.Error = &Error{Code: METHOD_NOT_FOUND, Message: fmt.Sprintf("method %q not found", req.Method)}
+		return resp
+	}
+	resp.Result, resp.Error = h(req.Params)
+	return resp
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	var req Request
+	var resp Response
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		resp = Response{JsonRpc: "2.0", Error: &Error{Code: PARSE_ERROR, Message: err.Error()}}
+	} else {
+		resp = server.Call(&req)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	type Params struct {
+		A, B int
+	}
+	server := NewServer()
+	Register(server, "add", func(params Params) (int, error) {
+		return params.A + params.B, nil
+	})
+	Register(server, "fail", func(params Params) (int, error) {
+		return 0, fmt.Errorf("failed")
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(body string) Response {
+		r, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		var resp Response
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := call(`{"jsonrpc":"2.0","method":"add","params":{"A":1,"B":2},"id":1}`); resp.Error != nil || resp.Result != 3.0 || string(resp.Id) != "1" {
+		t.Errorf("add: %+v", resp)
+	}
+	if resp := call(`{"jsonrpc":"2.0","method":"fail","id":2}`); resp.Error == nil || resp.Error.Code != INTERNAL_ERROR {
+		t.Errorf("fail: %+v", resp)
+	}
+	if resp := call(`{"jsonrpc":"2.0","method":"sub","id":3}`); resp.Error == nil || resp.Error.Code != METHOD_NOT_FOUND {
+		t.Errorf("sub: %+v", resp)
+	}
+	if resp := call(`{`); resp.Error == nil || resp.Error.Code != PARSE_ERROR {
+		t.Errorf("parse: %+v", resp)
+	}
+}
@@ -0,0 +1,99 @@
+package sim
+
+import (
+	"fmt"
+
+	c "gcoin/currency"
+	"gcoin/explorer"
+	"gcoin/index"
+	"gcoin/rpc"
+)
+
+// RegisterRPC exposes the node to rpc.Server
+func (node *Node) RegisterRPC(server *rpc.Server) {
+	type EstimateFeeParams struct {
+		Target uint64 // Blocks to confirm within
+	}
+	type EstimateFeeResult struct {
+		FeeRate uint64 // Per c.FEE_RATE_SCALE bytes
+	}
+	rpc.Register(server, "estimatefee", func(params EstimateFeeParams) (EstimateFeeResult, error) {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+
+		feeRate, err := node.protected.mempool.EstimateFeeRate(params.Target)
+		return EstimateFeeResult{FeeRate: feeRate}, err
+	})
+
+	type GetTransactionParams struct {
+		TxId c.TxId
+	}
+	rpc.Register(server, "gettransaction", func(params GetTransactionParams) (index.TxLocation, error) {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+
+		if node.protected.txIndex == nil {
+			return index.TxLocation{}, fmt.Errorf("txIndex disabled")
+		}
+		location, ok := node.protected.txIndex.Lookup(params.TxId)
+		if !ok {
+			return location, fmt.Errorf("txId %s not found", params.TxId)
+		}
+		return location, nil
+	})
+
+	type GetAddressHistoryParams struct {
+		Address c.Address
+	}
+	rpc.Register(server, "getaddresshistory", func(params GetAddressHistoryParams) ([]index.AddrEvent, error) {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+
+		if node.protected.addrIndex == nil {
+			return nil, fmt.Errorf("addrIndex disabled")
+		}
+		return node.protected.addrIndex.History(params.Address), nil
+	})
+}
+
+// Chain, Unspent, History and LookupTransaction implement explorer.Backend
+func (node *Node) Chain() c.Chain {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	// Blocks are only ever appended or the chain replaced on reorg
+	return node.protected.chain
+}
+
+func (node *Node) Unspent(address c.Address) []explorer.Utxo {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	utxoDb := &node.protected.utxoDb
+	var utxos []explorer.Utxo
+	for _, outPoint := range utxoDb.OutPoints(address) {
+		entry, _ := utxoDb.Entry(outPoint)
+		utxos = append(utxos, explorer.Utxo{OutPoint: outPoint, Entry: entry, Mature: utxoDb.IsMature(entry)})
+	}
+	return utxos
+}
+
+func (node *Node) History(address c.Address) ([]index.AddrEvent, bool) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if node.protected.addrIndex == nil {
+		return nil, false
+	}
+	return node.protected.addrIndex.History(address), true
+}
+
+func (node *Node) LookupTransaction(txId c.TxId) (index.TxLocation, bool) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if node.protected.txIndex == nil {
+		return index.TxLocation{}, false
+	}
+	return node.protected.txIndex.Lookup(txId)
+}
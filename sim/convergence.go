@@ -0,0 +1,87 @@
+package sim
+
+import (
+	"fmt"
+
+	"gcoin/blockchain"
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+const MAX_DIVERGENCE = 6 // Blocks past the common prefix a converged chain may have, as they may still be propagating
+
+/*
+ * Convergence is the verdict on whether the nodes agree on a chain.
+ *
+ * The chains pass if each has at most MAX_DIVERGENCE blocks past the deepest
+ * block common to all, and the UTXO sets of the nodes agree at that block:
+ * the set each node keeps is the one the common prefix builds, extended by
+ * the blocks of the node past it. A partition that never heals, or a victim
+ * of an eclipse, fails it.
+ */
+type Convergence struct {
+	Height     int       // Of the deepest common block, -1 if the chains share none
+	Hash       util.Hash // Of the deepest common block
+	Divergence []int     // Blocks past the common prefix, by node
+	UtxoAgree  bool      // The UTXO sets of the nodes agree at the deepest common block
+	Pass       bool
+	Reason     string // Why the chains fail, empty if they pass
+}
+
+// CheckConvergence compares the chains of nodes and their UTXO sets
+func CheckConvergence(nodes []*Node) Convergence {
+	chains := make([]c.Chain, len(nodes))
+	for i, node := range nodes {
+		chains[i] = node.Chain()
+	}
+	prefix := blockchain.CommonPrefix(chains...)
+	convergence := Convergence{Height: prefix - 1, UtxoAgree: true}
+	if prefix > 0 {
+		convergence.Hash = chains[0][prefix-1].BlockHash
+	}
+	fail := func(reason string) {
+		if convergence.Reason == "" {
+			convergence.Reason = reason
+		}
+	}
+
+	// Built once, the common prefix being the same in every chain
+	var common c.UtxoDb
+	var err error
+	if len(chains) != 0 {
+		if common, err = c.NewValidatedUtxoDbFromChain(chains[0][:prefix]); err != nil {
+			convergence.UtxoAgree = false
+			fail(fmt.Sprintf("common prefix: %v", err))
+		}
+	}
+	for i, chain := range chains {
+		divergence := len(chain) - prefix
+		convergence.Divergence = append(convergence.Divergence, divergence)
+		if divergence > MAX_DIVERGENCE {
+			fail(fmt.Sprintf("node %d has %d blocks past the common prefix", i, divergence))
+		}
+		if !convergence.UtxoAgree {
+			continue
+		}
+		if err := nodes[i].utxoMismatch(&common, chain[prefix:]); err != nil {
+			convergence.UtxoAgree = false
+			fail(fmt.Sprintf("UTXO set of node %d disagrees at the common prefix: %v", i, err))
+		}
+	}
+	convergence.Pass = convergence.Reason == ""
+	return convergence
+}
+
+// utxoMismatch compares the UTXO set of node with common, the one at
+// the common prefix, once the blocks of node past it are connected
+func (node *Node) utxoMismatch(common *c.UtxoDb, past c.Chain) error {
+	utxoDb := common.Clone()
+	for _, b := range past {
+		if err := utxoDb.ConnectBlock(&b); err != nil {
+			return fmt.Errorf("block %d: %w", b.BlockHeader.Index, err)
+		}
+	}
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.protected.utxoDb.Mismatch(&utxoDb)
+}
@@ -0,0 +1,244 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+const MAX_CONFIRMATIONS = 6 // Reported by Reversal, from 0
+const MATURITY_MARGIN = 2   // Blocks a coinbase spent by a payment matured before the tip, for peers behind it
+
+/*
+ * doubleSpender pays the merchant and reverses the payment in rounds:
+ *
+ * 1. The payment is relayed to the network while a private branch forks
+ *    from the public tip with a conflicting transaction, which spends the
+ *    same outpoints back to the attacker, in its first block
+ * 2. Once the merchant saw Strategy.Confirmations of the payment and the
+ *    branch has more cumulative Diff than the public chain, the branch is
+ *    published and the payment reversed
+ * 3. Once the public chain has Strategy.GiveUp blocks of work more than the
+ *    branch, the round is abandoned and the payment stands
+ *
+ * Before Scenario.Warmup, between rounds, and until it has mature funds to
+ * pay with, the node mines honestly. A hash share above 1/2 reverses every payment eventually.
+ */
+type doubleSpender struct {
+	strategy Strategy
+	merchant *Node
+	private  c.Chain
+	round    *round // nil between rounds
+	rounds   []round
+}
+
+// round is one attempt to reverse a payment
+type round struct {
+	payment  c.RegularTransaction // To the merchant
+	conflict c.RegularTransaction // Spending the same outpoints, mined privately
+	fork     int                  // Height of the first private block
+}
+
+// start pays the merchant and forks the private branch after Scenario.Warmup,
+// unless node has no funds confirmed and unspent by its mempool.
+// Assume node.mu is held
+func (ds *doubleSpender) start(node *Node) bool {
+	if node.sched.Elapsed() < time.Duration(node.scenario.Warmup) {
+		return false
+	}
+	utxoDb := &node.protected.utxoDb
+	view := node.protected.mempool.View(utxoDb)
+	payment, err := node.wallet.MakeRegularTransaction(view, ds.merchant.Address(), ds.strategy.Amount, node.scenario.Workload.Fee, node.sched)
+	if err != nil {
+		return false
+	}
+	// The conflict has to be valid at the fork, and the payment at peers
+	// that see a coinbase mature a few blocks later, as they drop it for good
+	for _, txIn := range payment.TxData.TxIns {
+		entry, ok := utxoDb.Entry(txIn.OutPoint)
+		if !ok || (entry.Coinbase && utxoDb.Height() < entry.Height+c.ActiveParams.CoinbaseMaturity+MATURITY_MARGIN) {
+			return false
+		}
+	}
+	var total uint64
+	for _, txOut := range payment.TxData.TxOuts {
+		total += txOut.Amount
+	}
+	conflict := node.wallet.SignTxData(c.TxData{
+		TxIns:     payment.TxData.TxIns,
+		TxOuts:    []c.TxOut{{Address: node.wallet.GetAddress(), Amount: total}},
+		Timestamp: node.sched.Now()}, payment.TransactionFee)
+	ds.private = slices.Clone(node.protected.chain)
+	ds.round = &round{payment: *payment, conflict: conflict, fork: len(ds.private)}
+	return true
+}
+
+func (ds *doubleSpender) nextBlock(node *Node) c.Block {
+	node.mu.Lock()
+	started := ds.round == nil && ds.start(node)
+	if ds.round == nil {
+		node.mu.Unlock()
+		return node.honestBlock()
+	}
+	var txns []c.RegularTransaction
+	if len(ds.private) == ds.round.fork {
+		txns = []c.RegularTransaction{ds.round.conflict}
+	}
+	b := privateBlock(node, ds.private, txns)
+	node.mu.Unlock()
+
+	if started {
+		ds.merchant.watch(ds.round.payment.TxId)
+		node.submitTransaction(ds.round.payment)
+	}
+	return b
+}
+
+func (ds *doubleSpender) blockMined(node *Node, b c.Block) {
+	if ds.round == nil {
+		node.publishMined(b)
+		return
+	}
+	ds.private = append(ds.private, b)
+	node.metrics.minedBlocks.Inc()
+	ds.tryPublish(node)
+	node.restartMining()
+}
+
+// tryPublish publishes the private branch once it reverses a payment
+// with enough confirmations
+func (ds *doubleSpender) tryPublish(node *Node) {
+	public := node.Chain()
+	if ds.private.Difficulty() <= public.Difficulty() ||
+		ds.merchant.Confirmations(ds.round.payment.TxId) < ds.strategy.Confirmations {
+		return
+	}
+	for _, b := range ds.private[ds.round.fork:] {
+		node.publishWithheld(b, 0)
+	}
+	ds.end()
+}
+
+// end closes the current round
+func (ds *doubleSpender) end() {
+	ds.rounds = append(ds.rounds, *ds.round)
+	ds.round = nil
+	ds.private = nil
+}
+
+func (ds *doubleSpender) tipChanged(node *Node) {
+	if ds.round == nil {
+		return
+	}
+	ds.tryPublish(node)
+	if ds.round != nil && ds.strategy.GiveUp != 0 && ds.behind(node) >= uint64(ds.strategy.GiveUp) {
+		ds.end()
+		node.restartMining()
+	}
+}
+
+// behind is the cumulative Diff of the public chain past the private branch,
+// in blocks of work at the target of the public tip
+func (ds *doubleSpender) behind(node *Node) uint64 {
+	public := node.Chain()
+	if ds.private.Difficulty() >= public.Difficulty() {
+		return 0
+	}
+	work := uint64(1) << util.Last(public).BlockHeader.Target
+	return (public.Difficulty() - ds.private.Difficulty()) / work
+}
+
+// Reversal estimates the probability that a payment is reversed once
+// the merchant saw Confirmations of it. Above Strategy.Confirmations it is
+// a lower bound, as the attacker publishes as soon as it can.
+type Reversal struct {
+	Confirmations int
+	Payments      int     // Seen with Confirmations, and settled in the main chain
+	Reversed      int     // Of Payments, those the main chain holds the conflict of
+	Probability   float64 // Reversed / Payments
+	Nakamoto      float64 // Expected for the hash share if the attacker never gives up
+}
+
+// reversals settles the finished rounds against main
+func (ds *doubleSpender) reversals(main c.Chain, hashShare float64) []Reversal {
+	var reversals []Reversal
+	for k := range MAX_CONFIRMATIONS + 1 {
+		reversal := Reversal{Confirmations: k, Nakamoto: NakamotoProbability(hashShare, k)}
+		for _, round := range ds.rounds {
+			if ds.merchant.Confirmations(round.payment.TxId) < k {
+				continue
+			}
+			switch {
+			case confirmations(main, round.conflict.TxId) != 0:
+				reversal.Reversed++
+			case confirmations(main, round.payment.TxId) == 0:
+				continue // Neither in the main chain yet
+			}
+			reversal.Payments++
+		}
+		if reversal.Payments != 0 {
+			reversal.Probability = float64(reversal.Reversed) / float64(reversal.Payments)
+		}
+		reversals = append(reversals, reversal)
+	}
+	return reversals
+}
+
+// NakamotoProbability is the probability that an attacker with hash share q
+// ever catches up with a chain z blocks ahead, from section 11 of the
+// Bitcoin paper
+func NakamotoProbability(q float64, z int) float64 {
+	p := 1 - q
+	if q >= p {
+		return 1
+	}
+	lambda := float64(z) * q / p
+	sum := 1.0
+	poisson := math.Exp(-lambda)
+	for k := 0; k <= z; k++ {
+		if k > 0 {
+			poisson *= lambda / float64(k)
+		}
+		sum -= poisson * (1 - math.Pow(q/p, float64(z-k)))
+	}
+	return sum
+}
+
+// Sweep runs scenario once for each hash share of the node of its strategy
+// at index, scaling its hash rate against the others, and returns the
+// AttackResult of the strategy in each run
+func Sweep(scenario Scenario, index int, shares []float64) ([]AttackResult, error) {
+	if index < 0 || index >= len(scenario.Strategies) {
+		return nil, fmt.Errorf("strategy %d out of range", index)
+	}
+	attacker := scenario.Strategies[index].Node
+	hashRates := make([]float64, scenario.Nodes)
+	var others float64
+	for i := range hashRates {
+		hashRates[i] = DEFAULT_HASH_RATE
+		if i < len(scenario.HashRates) && scenario.HashRates[i] > 0 {
+			hashRates[i] = scenario.HashRates[i]
+		}
+		if i != attacker {
+			others += hashRates[i]
+		}
+	}
+	var attacks []AttackResult
+	for _, share := range shares {
+		if share <= 0 || share >= 1 {
+			return nil, fmt.Errorf("hash share %v not in (0, 1)", share)
+		}
+		hashRates[attacker] = share / (1 - share) * others
+		scenario.HashRates = slices.Clone(hashRates)
+		result, err := Run(scenario)
+		if err != nil {
+			return nil, err
+		}
+		attacks = append(attacks, result.Attacks[index])
+	}
+	return attacks, nil
+}
@@ -0,0 +1,243 @@
+package sim
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+const STALE_LAG = 2                         // Blocks of the main chain a node lacks to be on a stale tip
+const STALE_SAMPLE = 100 * time.Millisecond // Between two checks of the tip of a victim
+
+/*
+ * Eclipse lets Sybils take over the peer slots of Victim from At until Heal.
+ *
+ * The Sybils share an address range, so a victim enforcing Diversity gives
+ * them at most that many of its slots and keeps honest peers in the rest.
+ * The links of the victim to the honest peers it loses are cut both ways.
+ * The Sybils relay nothing to the victim but the blocks of a fork they mine
+ * on top of its chain at ForkHashRate, so the victim mines on a chain of less
+ * work than the honest one, and with WithholdTransactions no transactions.
+ */
+type Eclipse struct {
+	Victim               int
+	Sybils               []int
+	At                   Duration
+	Heal                 Duration // 0 to never heal
+	Diversity            int      // Most peer slots of the victim the Sybils may take, 0 for no limit
+	ForkHashRate         float64  // Hashes per second of the fork fed to the victim, 0 for none
+	WithholdTransactions bool
+}
+
+func (eclipse *Eclipse) Validate(n int) error {
+	if eclipse.Victim < 0 || eclipse.Victim >= n {
+		return fmt.Errorf("victim %d out of range", eclipse.Victim)
+	}
+	if len(eclipse.Sybils) == 0 {
+		return fmt.Errorf("no sybils")
+	}
+	for k, i := range eclipse.Sybils {
+		if i < 0 || i >= n || i == eclipse.Victim || slices.Contains(eclipse.Sybils[:k], i) {
+			return fmt.Errorf("sybil %d invalid", i)
+		}
+	}
+	if eclipse.At < 0 || (eclipse.Heal != 0 && eclipse.Heal <= eclipse.At) {
+		return fmt.Errorf("eclipse from %v to %v invalid", time.Duration(eclipse.At), time.Duration(eclipse.Heal))
+	}
+	if eclipse.Diversity < 0 || eclipse.ForkHashRate < 0 {
+		return fmt.Errorf("negative diversity or fork hash rate")
+	}
+	return nil
+}
+
+// EclipseResult measures how the victim of an Eclipse fared
+type EclipseResult struct {
+	Victim      int
+	SybilPeers  int      // Peer slots of the victim taken by Sybils
+	HonestPeers int      // Peer slots of the victim left to honest nodes
+	StaleTime   Duration // Spent on a stale tip from the start of the eclipse
+	Recovery    Duration // From the heal to the first check off a stale tip, -1 if it did not recover
+	ForkBlocks  int      // Fed to the victim by the Sybils
+	MinedOnFork int      // Blocks the victim mined on top of the fork
+}
+
+// eclipse runs an Eclipse of sim
+type eclipse struct {
+	Eclipse
+	sim    *Simulation
+	victim *Node
+	sybil  *Node              // Sending the fork to the victim
+	peers  map[*Node][]*peer  // Before the eclipse, of the nodes it relinks
+	fork   map[util.Hash]bool // Blocks fed to the victim
+	result EclipseResult
+	healed bool
+}
+
+func newEclipse(sim *Simulation, e Eclipse) *eclipse {
+	return &eclipse{
+		Eclipse: e,
+		sim:     sim,
+		victim:  sim.Nodes[e.Victim],
+		peers:   make(map[*Node][]*peer),
+		fork:    make(map[util.Hash]bool),
+		result:  EclipseResult{Victim: e.Victim, Recovery: -1}}
+}
+
+// schedule starts, samples and heals the eclipse
+func (e *eclipse) schedule() {
+	sched := e.sim.Scheduler
+	sched.After(time.Duration(e.At), func() {
+		e.start()
+		e.sample()
+		if e.ForkHashRate > 0 && e.sybil != nil {
+			e.feed()
+		}
+	})
+	if e.Heal != 0 {
+		sched.After(time.Duration(e.Heal), e.heal)
+	}
+}
+
+// relink saves the peers of node once, to be restored on heal
+func (e *eclipse) relink(node *Node) {
+	if _, ok := e.peers[node]; !ok {
+		e.peers[node] = slices.Clone(node.peers)
+	}
+}
+
+// start hands the peer slots of the victim to the Sybils, those already
+// peers first, up to Diversity, then fills the rest with honest peers
+func (e *eclipse) start() {
+	victim := e.victim
+	slots := len(victim.peers)
+	if e.Diversity > 0 {
+		slots = min(slots, e.Diversity)
+	}
+	var sybils []int
+	for _, peered := range []bool{true, false} {
+		for _, i := range e.Sybils {
+			if (victim.peer(e.sim.Nodes[i]) != nil) == peered && len(sybils) < slots {
+				sybils = append(sybils, i)
+			}
+		}
+	}
+
+	e.relink(victim)
+	var peers []*peer
+	for _, i := range sybils {
+		sybil := e.sim.Nodes[i]
+		e.relink(sybil)
+		if victim.peer(sybil) == nil {
+			link := e.sim.Scenario.LinkOf(e.Victim, i)
+			victim.connect(sybil, link)
+			sybil.connect(victim, link)
+		}
+		peers = append(peers, victim.peer(sybil))
+		hide := []string{"block", "blocks"}
+		if e.WithholdTransactions {
+			hide = append(hide, "tx")
+		}
+		sybil.peer(victim).hide = hide
+	}
+	for _, p := range e.peers[victim] {
+		if len(peers) == len(e.peers[victim]) {
+			break
+		}
+		if !slices.Contains(e.Sybils, p.node.id) {
+			peers = append(peers, p)
+		}
+	}
+	for _, p := range e.peers[victim] {
+		if !slices.Contains(peers, p) {
+			e.relink(p.node)
+			p.node.setPeers(slices.DeleteFunc(p.node.peers, func(q *peer) bool { return q.node == victim }))
+		}
+	}
+	victim.setPeers(peers)
+	e.result.SybilPeers = len(sybils)
+	e.result.HonestPeers = len(peers) - len(sybils)
+	if len(sybils) != 0 {
+		e.sybil = e.sim.Nodes[sybils[0]]
+	}
+}
+
+// heal restores the peers from before the eclipse
+func (e *eclipse) heal() {
+	for node, peers := range e.peers {
+		node.setPeers(peers)
+		for _, p := range peers {
+			p.hide = nil
+		}
+	}
+	e.healed = true
+}
+
+// feed mines the next block of the fork on the chain of the victim
+// and sends it from a Sybil, until the eclipse heals
+func (e *eclipse) feed() {
+	sybil := e.sybil
+	chain := e.victim.Chain()
+	bt := c.NewBlockTransactions(nil, sybil.Address(), uint64(len(chain)), e.sim.Scheduler)
+	target := chain.NextUnmintedBlock(bt, e.sim.Scheduler).BlockHeader.Target
+	hashes := sybil.rd.ExpFloat64() * float64(uint64(1)<<target)
+	e.sim.Scheduler.After(time.Duration(hashes/e.ForkHashRate*float64(time.Second)), func() {
+		if e.healed {
+			return
+		}
+		chain := e.victim.Chain()
+		bt := c.NewBlockTransactions(nil, sybil.Address(), uint64(len(chain)), e.sim.Scheduler)
+		b := chain.NextUnmintedBlock(bt, e.sim.Scheduler)
+		b.Mine()
+		e.fork[b.BlockHash] = true
+		e.result.ForkBlocks++
+		size := BLOCK_HEADER_SIZE + b.Data.Size()
+		sybil.originate("block", b.BlockHash, size)
+		prov := sybil.forward(b.BlockHash)
+		sybil.send(sybil.peer(e.victim), "fork", size, func() {
+			e.victim.receiveBlock(sybil, b, 0, prov)
+		})
+		e.feed()
+	})
+}
+
+// sample adds up the time the victim spends on a stale tip, every STALE_SAMPLE
+func (e *eclipse) sample() {
+	main := e.sim.mainChain()
+	stale := len(main)-main.ForkIndex(e.victim.Chain()) >= STALE_LAG
+	if stale {
+		e.result.StaleTime += Duration(STALE_SAMPLE)
+	} else if e.healed && e.result.Recovery < 0 {
+		e.result.Recovery = Duration(e.sim.Scheduler.Elapsed() - time.Duration(e.Heal))
+	}
+	e.sim.Scheduler.After(STALE_SAMPLE, e.sample)
+}
+
+// minedOnFork counts the blocks the victim mined with a fork block as ancestor
+func (e *eclipse) minedOnFork() int {
+	victim := e.victim
+	onFork := make(map[util.Hash]bool)
+	var descends func(hash util.Hash) bool
+	descends = func(hash util.Hash) bool {
+		if e.fork[hash] {
+			return true
+		}
+		if v, ok := onFork[hash]; ok {
+			return v
+		}
+		b, ok := victim.blocks[hash]
+		v := ok && b.BlockHeader.Index != 0 && descends(b.BlockHeader.PrevHash)
+		onFork[hash] = v
+		return v
+	}
+	mined := 0
+	address := victim.Address()
+	for hash, b := range victim.blocks {
+		if out, ok := reward(&b); ok && out.Address == address && descends(hash) {
+			mined++
+		}
+	}
+	return mined
+}
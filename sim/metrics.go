@@ -0,0 +1,66 @@
+package sim
+
+import (
+	"gcoin/metrics"
+	"gcoin/util"
+)
+
+// nodeMetrics are updated without holding node.mu
+type nodeMetrics struct {
+	registry     *metrics.Registry
+	hashRate     *metrics.Gauge
+	minedBlocks  *metrics.Counter
+	staleBlocks  *metrics.Counter
+	orphanBlocks *metrics.Counter
+	reorgDepth   *metrics.Histogram
+	messagesIn   *metrics.CounterVec
+	messagesOut  *metrics.CounterVec
+	messagesLost *metrics.CounterVec
+	failures     *metrics.CounterVec
+}
+
+// initMetrics registers the metrics of the node, those read from
+// node.protected or peers are gauges evaluated at every scrape under node.mu
+func (node *Node) initMetrics() {
+	registry := metrics.NewRegistry()
+	protected := func(f func() float64) func() float64 {
+		return func() float64 {
+			node.mu.Lock()
+			defer node.mu.Unlock()
+			return f()
+		}
+	}
+	registry.NewGaugeFunc("gcoin_tip_height", "Height of the tip of the main chain",
+		protected(func() float64 { return float64(len(node.protected.chain)) - 1 }))
+	registry.NewGaugeFunc("gcoin_tip_diff", "Cumulative difficulty of the main chain",
+		protected(func() float64 { return float64(node.protected.chain.Difficulty()) }))
+	registry.NewGaugeFunc("gcoin_tip_target", "Target of the tip",
+		protected(func() float64 {
+			if last := util.Last(node.protected.chain); last != nil {
+				return float64(last.BlockHeader.Target)
+			}
+			return 0
+		}))
+	node.metrics = nodeMetrics{
+		registry:     registry,
+		hashRate:     registry.NewGauge("gcoin_hash_rate", "Hashes per second the node mines at"),
+		minedBlocks:  registry.NewCounter("gcoin_blocks_mined_total", "Blocks mined locally and connected"),
+		staleBlocks:  registry.NewCounter("gcoin_stale_blocks_total", "Blocks mined on a stale tip or dropped by a reorg"),
+		orphanBlocks: registry.NewCounter("gcoin_orphan_blocks_total", "Blocks received before an ancestor"),
+		reorgDepth:   registry.NewHistogram("gcoin_reorg_depth", "Blocks disconnected per reorg", []float64{1, 2, 3, 5, 8, 13}),
+	}
+	registry.NewGaugeFunc("gcoin_mempool_transactions", "Transactions in the mempool",
+		protected(func() float64 { return float64(node.protected.mempool.Len()) }))
+	registry.NewGaugeFunc("gcoin_mempool_bytes", "Size of the transactions in the mempool",
+		protected(func() float64 { return float64(node.protected.mempool.Size()) }))
+	registry.NewGaugeFunc("gcoin_peers", "Peers blocks and transactions are relayed to",
+		protected(func() float64 { return float64(len(node.peers)) }))
+	node.metrics.messagesIn = registry.NewCounterVec("gcoin_messages_received_total", "Messages received from peers", "type")
+	node.metrics.messagesOut = registry.NewCounterVec("gcoin_messages_sent_total", "Messages sent to peers", "type")
+	node.metrics.messagesLost = registry.NewCounterVec("gcoin_messages_lost_total", "Messages sent to peers and lost", "reason")
+	node.metrics.failures = registry.NewCounterVec("gcoin_validation_failures_total", "Blocks and transactions rejected", "reason")
+}
+
+func (node *Node) Metrics() *metrics.Registry {
+	return node.metrics.registry
+}
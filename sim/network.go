@@ -0,0 +1,161 @@
+package sim
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+const (
+	LATENCY_CONSTANT    = "constant"    // Every message takes Link.Latency
+	LATENCY_EXPONENTIAL = "exponential" // Exponentially distributed with mean Link.Latency
+)
+
+const BLOCK_HEADER_SIZE = 97 // Bytes of the fields of blockchain.BlockHeader
+const HASH_SIZE = 32         // Bytes of a util.Hash in a message
+
+/*
+ * Link models the messages sent from a node to a peer.
+ *
+ * A message is transmitted at Bandwidth after the ones queued before it,
+ * then arrives after a delay drawn from Distribution around Latency plus
+ * up to Jitter, so messages may overtake each other. A lost message still
+ * takes its share of the bandwidth.
+ */
+type Link struct {
+	Latency      Duration
+	Distribution string   // LATENCY_CONSTANT if empty
+	Jitter       Duration // Added uniformly at random to the delay
+	Bandwidth    float64  // Bytes per second, 0 for unlimited
+	Loss         float64  // Probability that a message is lost
+}
+
+func (link *Link) Validate() error {
+	if link.Latency < 0 || link.Jitter < 0 {
+		return fmt.Errorf("negative latency or jitter")
+	}
+	switch link.Distribution {
+	case "", LATENCY_CONSTANT, LATENCY_EXPONENTIAL:
+	default:
+		return fmt.Errorf("unknown latency distribution %q", link.Distribution)
+	}
+	if link.Bandwidth < 0 {
+		return fmt.Errorf("negative bandwidth")
+	}
+	if link.Loss < 0 || link.Loss > 1 {
+		return fmt.Errorf("loss %v not a probability", link.Loss)
+	}
+	return nil
+}
+
+// delay draws the time a message takes to arrive once transmitted
+func (link *Link) delay(rd *rand.Rand) time.Duration {
+	delay := time.Duration(link.Latency)
+	if link.Distribution == LATENCY_EXPONENTIAL {
+		delay = time.Duration(rd.ExpFloat64() * float64(delay))
+	}
+	if link.Jitter > 0 {
+		delay += time.Duration(rd.Int64N(int64(link.Jitter)))
+	}
+	return delay
+}
+
+// transmission is how long size bytes take at the bandwidth of link
+func (link *Link) transmission(size int) time.Duration {
+	if link.Bandwidth == 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / link.Bandwidth * float64(time.Second))
+}
+
+// PeerLink replaces Scenario.Link between two peers, in both directions
+type PeerLink struct {
+	Nodes [2]int
+	Link  Link
+}
+
+// Partition splits the nodes into Groups from At until Heal. Messages sent
+// between groups are lost, nodes in no group form a group of their own.
+type Partition struct {
+	At     Duration
+	Heal   Duration // 0 to never heal
+	Groups [][]int
+}
+
+func (partition *Partition) Validate(n int) error {
+	if partition.At < 0 || (partition.Heal != 0 && partition.Heal <= partition.At) {
+		return fmt.Errorf("partition from %v to %v invalid", time.Duration(partition.At), time.Duration(partition.Heal))
+	}
+	seen := make(map[int]bool)
+	for _, group := range partition.Groups {
+		for _, i := range group {
+			if i < 0 || i >= n {
+				return fmt.Errorf("node %d out of range", i)
+			}
+			if seen[i] {
+				return fmt.Errorf("node %d in two groups", i)
+			}
+			seen[i] = true
+		}
+	}
+	return nil
+}
+
+// group is the index of the group of node i, len(Groups) for the rest
+func (partition *Partition) group(i int) int {
+	for g, group := range partition.Groups {
+		if slices.Contains(group, i) {
+			return g
+		}
+	}
+	return len(partition.Groups)
+}
+
+// Separates reports whether nodes i and j are in different groups at
+func (partition *Partition) Separates(at time.Duration, i int, j int) bool {
+	if at < time.Duration(partition.At) || (partition.Heal != 0 && at >= time.Duration(partition.Heal)) {
+		return false
+	}
+	return partition.group(i) != partition.group(j)
+}
+
+// peer is the end of a link from a node
+type peer struct {
+	node *Node
+	link Link
+	busy time.Duration // Until the messages queued so far are transmitted
+	hide []string      // Kinds of messages dropped, by a Sybil to its victim
+}
+
+// send delivers a message of size bytes to p over their link, unless it is lost
+func (node *Node) send(p *peer, kind string, size int, deliver func()) {
+	if slices.Contains(p.hide, kind) {
+		node.metrics.messagesLost.With("eclipse").Inc()
+		return
+	}
+	node.metrics.messagesOut.With(kind).Inc()
+	now := node.sched.Elapsed()
+	p.busy = max(p.busy, now) + p.link.transmission(size)
+	for i := range node.scenario.Partitions {
+		if node.scenario.Partitions[i].Separates(now, node.id, p.node.id) {
+			node.metrics.messagesLost.With("partition").Inc()
+			return
+		}
+	}
+	if p.link.Loss > 0 && node.rd.Float64() < p.link.Loss {
+		node.metrics.messagesLost.With("loss").Inc()
+		return
+	}
+	node.sched.After(p.busy-now+p.link.delay(&node.rd), deliver)
+}
+
+// peer returns the link from node to other, nil if they are not peers
+func (node *Node) peer(other *Node) *peer {
+	for _, p := range node.peers {
+		if p.node == other {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,598 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"gcoin/blockchain"
+	c "gcoin/currency"
+	"gcoin/events"
+	"gcoin/index"
+	"gcoin/mempool"
+	"gcoin/util"
+)
+
+// Node is a miner and wallet relaying blocks and transactions to its peers
+type Node struct {
+	mu        sync.Mutex
+	protected struct {
+		chain     c.Chain
+		utxoDb    c.UtxoDb
+		mempool   mempool.Mempool
+		txIndex   *index.TxIndex   // nil unless Scenario.Index
+		addrIndex *index.AddrIndex // nil unless Scenario.Index
+		indexers  []index.Indexer
+		balance   events.WalletBalanceChanged // Last published
+		watched   map[c.TxId]int              // TxId -> most confirmations seen
+	}
+	id        int
+	txIds     map[c.TxId]struct{}   // Exclusive to handleTransaction
+	blocks    map[util.Hash]c.Block // Received or mined, the ancestors of each included
+	rd        rand.Rand
+	ties      rand.Rand // Of handleBlock alone, so a Replay draws the same
+	peers     []*peer   // Replaced under mu, for scrapes of gcoin_peers
+	sched     *Scheduler
+	wallet    c.Wallet
+	hashRate  float64                  // Hashes per second
+	mining    uint64                   // Generation of the block being mined, bumped by every new tip
+	agent     agent                    // nil for an honest node
+	collector *collector               // Of the Report of the Simulation
+	tracer    *Tracer                  // nil unless the Simulation is recorded
+	seen      map[util.Hash]Provenance // Of the first arrival of each block and transaction
+	arrivals  []Arrival
+	scenario  *Scenario
+	metrics   nodeMetrics
+	bus       *events.Bus
+}
+
+func NewNode(id int, scenario *Scenario, sched *Scheduler) *Node {
+	node := &Node{
+		id:       id,
+		txIds:    make(map[c.TxId]struct{}),
+		blocks:   make(map[util.Hash]c.Block),
+		seen:     make(map[util.Hash]Provenance),
+		rd:       *rand.New(rand.NewPCG(scenario.Seed, uint64(id))),
+		ties:     *rand.New(rand.NewPCG(scenario.Seed, uint64(id)|1<<63)),
+		sched:    sched,
+		hashRate: DEFAULT_HASH_RATE,
+		scenario: scenario,
+		bus:      events.NewBus(sched)}
+	var seed [32]byte
+	for i := range seed {
+		seed[i] = byte(node.rd.Uint32())
+	}
+	node.wallet = c.NewWalletFromSeed(seed)
+	if id < len(scenario.HashRates) && scenario.HashRates[id] > 0 {
+		node.hashRate = scenario.HashRates[id]
+	}
+	node.initMetrics()
+	node.metrics.hashRate.Set(node.hashRate)
+	node.protected.utxoDb = c.NewUtxoDb()
+	node.protected.watched = make(map[c.TxId]int)
+	node.protected.mempool = mempool.NewMempool(mempool.DEFAULT_MAX_SIZE, mempool.DEFAULT_EXPIRY, sched)
+	node.protected.mempool.Subscribe(node.bus)
+	if scenario.Index {
+		txIndex := index.NewTxIndex()
+		addrIndex := index.NewAddrIndex()
+		node.protected.txIndex = &txIndex
+		node.protected.addrIndex = &addrIndex
+		node.protected.indexers = []index.Indexer{&txIndex, &addrIndex}
+	}
+	return node
+}
+
+// connect relays the blocks and transactions of node to other over link
+func (node *Node) connect(other *Node, link Link) {
+	node.peers = append(node.peers, &peer{node: other, link: link})
+}
+
+// setPeers replaces the peers of node while it runs
+func (node *Node) setPeers(peers []*peer) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	node.peers = peers
+}
+
+func (node *Node) Address() c.Address {
+	return node.wallet.GetAddress()
+}
+
+func (node *Node) Bus() *events.Bus {
+	return node.bus
+}
+
+// broadcast sends a message of size bytes to every peer
+func (node *Node) broadcast(kind string, size int, deliver func(peer *Node)) {
+	for _, p := range node.peers {
+		node.send(p, kind, size, func() { deliver(p.node) })
+	}
+}
+
+// broadcastBlock relays b to every peer, see handleBlock for gamma
+func (node *Node) broadcastBlock(b c.Block, gamma float64) {
+	prov := node.forward(b.BlockHash)
+	node.broadcast("block", BLOCK_HEADER_SIZE+b.Data.Size(), func(peer *Node) { peer.receiveBlock(node, b, gamma, prov) })
+}
+
+// broadcastTransaction relays txn to every peer
+func (node *Node) broadcastTransaction(txn c.RegularTransaction) {
+	prov := node.forward(txn.TxId)
+	node.broadcast("tx", txn.Size(), func(peer *Node) { peer.receiveTransaction(node, txn, prov) })
+}
+
+// prepareNextUnmintedBlock prepares the next block to be mined by:
+// 1. Selecting mempool transactions by fee rate up to the block size limit
+// 2. Creating a new block with the block template
+// unless the agent of node decides otherwise
+func (node *Node) prepareNextUnmintedBlock() c.Block {
+	if node.agent != nil {
+		return node.agent.nextBlock(node)
+	}
+	return node.honestBlock()
+}
+
+// honestBlock is the next block of an honest node on its chain
+func (node *Node) honestBlock() c.Block {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	address := node.wallet.GetAddress()
+	txns := node.protected.mempool.Transactions()
+	tmpl := c.NewBlockTemplate(&node.protected.utxoDb, txns, address, c.ActiveParams.MaxBlockSize, node.sched)
+	return node.protected.chain.NextUnmintedBlock(tmpl.BlockTransactions(), node.sched)
+}
+
+// Mine prepares the next block, which is found after a delay drawn as for
+// 2^Target hashes on average at the hash rate of node, unless the tip changes
+// in the meantime. Only found blocks are ground, for their proof of work.
+func (node *Node) Mine() {
+	b := node.prepareNextUnmintedBlock()
+	hashes := node.rd.ExpFloat64() * float64(uint64(1)<<b.BlockHeader.Target)
+	generation := node.mining
+	node.sched.After(time.Duration(hashes/node.hashRate*float64(time.Second)), func() {
+		if node.mining != generation {
+			return // Mining on a stale tip
+		}
+		b.Mine()
+		if node.agent != nil {
+			node.agent.blockMined(node, b)
+			return
+		}
+		node.publishMined(b)
+	})
+}
+
+// publishMined connects and relays b as an honest node does
+func (node *Node) publishMined(b c.Block) {
+	node.record(TRACE_MINED, node, 0, []c.Block{b}, nil)
+	if err := node.handleMinedBlock(b); err != nil {
+		node.restartMining()
+		return
+	}
+	node.originate("block", b.BlockHash, BLOCK_HEADER_SIZE+b.Data.Size())
+	node.broadcastBlock(b, 0)
+}
+
+// publishWithheld connects and relays b, which the agent of node withheld
+// so far, see handleBlock for gamma
+func (node *Node) publishWithheld(b c.Block, gamma float64) {
+	node.record(TRACE_PUBLISH, node, 0, []c.Block{b}, nil)
+	if err := node.handleBlock(b, 0); err == nil {
+		node.originate("block", b.BlockHash, BLOCK_HEADER_SIZE+b.Data.Size())
+		node.broadcastBlock(b, gamma)
+	}
+}
+
+// restartMining abandons the block being mined for one on the new tip
+func (node *Node) restartMining() {
+	node.mining++
+	generation := node.mining
+	node.sched.After(0, func() {
+		if node.mining == generation {
+			node.Mine()
+		}
+	})
+}
+
+var errOrphan = errors.New("orphan")
+
+// handleBlock processes an incoming block by:
+// 1. Validating the block
+// 2. Checking for duplicates and missing ancestors
+// 3. Rebuilding the chain if the block has higher difficulty, or the same
+// with probability gamma, which models how many honest nodes a selfish
+// miner wins over in a tie
+// Returns error if block is invalid, duplicate or an orphan
+func (node *Node) handleBlock(b c.Block, gamma float64) error {
+	if err := b.Validate(node.sched); err != nil {
+		node.metrics.failures.With("invalid_block").Inc()
+		return err
+	}
+
+	_, ok := node.blocks[b.BlockHash]
+	if ok {
+		return fmt.Errorf("duplicate found")
+	}
+	// Kept out of node.blocks until its ancestors are received
+	if node.isOrphan(&b) {
+		node.metrics.orphanBlocks.Inc()
+		return errOrphan
+	}
+	node.blocks[b.BlockHash] = b
+	node.collector.blockStored(b.BlockHash)
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if diff := node.protected.chain.Difficulty(); b.BlockHeader.Diff < diff ||
+		(b.BlockHeader.Diff == diff && (gamma == 0 || node.ties.Float64() >= gamma)) {
+		return nil
+	}
+
+	if err := node.protected.chain.ValidateNextBlock(&b, node.sched); err != nil {
+		chain, err := blockchain.RebuildChain(node.blocks, b, node.sched)
+		if err != nil {
+			node.metrics.failures.With("invalid_chain").Inc()
+			return err
+		}
+		utxoDb, err := c.NewValidatedUtxoDbFromChain(chain)
+		if err != nil {
+			node.metrics.failures.With("invalid_utxo").Inc()
+			return err
+		}
+		node.reorganize(chain, utxoDb)
+		return nil
+	}
+	if err := node.connectBlock(&b); err != nil {
+		node.metrics.failures.With("invalid_utxo").Inc()
+		return err
+	}
+	return nil
+}
+
+// isOrphan reports whether the parent of b has not been received yet
+func (node *Node) isOrphan(b *c.Block) bool {
+	_, ok := node.blocks[b.BlockHeader.PrevHash]
+	return b.BlockHeader.Index != 0 && !ok
+}
+
+// connectBlock appends b to the chain and drops its transactions from the mempool
+// Assume node.mu is held
+func (node *Node) connectBlock(b *c.Block) error {
+	if err := node.protected.utxoDb.ConnectBlock(b); err != nil {
+		return err
+	}
+	node.protected.chain = append(node.protected.chain, *b)
+	for _, indexer := range node.protected.indexers {
+		indexer.ConnectBlock(b)
+	}
+	node.bus.PublishBlockConnected(b)
+	node.protected.mempool.ConnectBlock(&b.Data)
+	node.protected.mempool.Expire(node.sched.Now())
+	node.bus.PublishNewTip(b)
+	node.publishBalance()
+	node.updateWatched()
+	node.restartMining()
+	return nil
+}
+
+// watch records the most confirmations txId gets in the chain of node
+func (node *Node) watch(txId c.TxId) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	node.protected.watched[txId] = confirmations(node.protected.chain, txId)
+}
+
+// Confirmations is the most confirmations a watched txId got
+func (node *Node) Confirmations(txId c.TxId) int {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	return node.protected.watched[txId]
+}
+
+// updateWatched counts the confirmations of the watched transactions at the tip.
+// Assume node.mu is held
+func (node *Node) updateWatched() {
+	for txId, most := range node.protected.watched {
+		node.protected.watched[txId] = max(most, confirmations(node.protected.chain, txId))
+	}
+}
+
+// confirmations is the number of blocks from the one confirming txId to the tip of chain
+func confirmations(chain c.Chain, txId c.TxId) int {
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, txn := range chain[i].Data.RTxns {
+			if txn.TxId == txId {
+				return len(chain) - i
+			}
+		}
+	}
+	return 0
+}
+
+// publishBalance publishes the funds of the wallet if they have changed
+// Assume node.mu is held
+func (node *Node) publishBalance() {
+	address := node.wallet.GetAddress()
+	balance, immature := node.protected.utxoDb.Funds(address)
+	event := events.WalletBalanceChanged{Address: address, Balance: balance, Immature: immature}
+	if event != node.protected.balance {
+		node.protected.balance = event
+		node.bus.Publish(event)
+	}
+}
+
+// reorganize switches to chain by:
+// 1. Moving the indexes from the dropped blocks to the new ones
+// 2. Dropping the transactions confirmed by the new blocks from the mempool
+// 3. Re-admitting the transactions of the dropped blocks that are still valid
+// 4. Dropping the transactions that spend outputs lost in the reorg
+// 5. Publishing the disconnected and connected blocks, then the new tip
+// Assume node.mu is held
+func (node *Node) reorganize(chain c.Chain, utxoDb c.UtxoDb) {
+	old := node.protected.chain
+	fork := old.ForkIndex(chain)
+	if depth := len(old) - fork; depth > 0 {
+		node.metrics.reorgDepth.Observe(float64(depth))
+		node.metrics.staleBlocks.Add(uint64(depth))
+		node.collector.reorg(depth)
+	}
+	node.protected.chain = chain
+	node.protected.utxoDb = utxoDb
+	for _, indexer := range node.protected.indexers {
+		for i := len(old) - 1; i >= fork; i-- {
+			indexer.DisconnectBlock(&old[i])
+		}
+		for i := fork; i < len(chain); i++ {
+			indexer.ConnectBlock(&chain[i])
+		}
+	}
+	for i := len(old) - 1; i >= fork; i-- {
+		node.bus.PublishBlockDisconnected(&old[i])
+	}
+	for i := fork; i < len(chain); i++ {
+		node.bus.PublishBlockConnected(&chain[i])
+		node.protected.mempool.ConnectBlock(&chain[i].Data)
+	}
+	for i := fork; i < len(old); i++ {
+		node.protected.mempool.DisconnectBlock(&old[i].Data, &node.protected.utxoDb)
+	}
+	node.protected.mempool.Revalidate(&node.protected.utxoDb)
+	node.protected.mempool.Expire(node.sched.Now())
+	node.bus.PublishNewTip(util.Last(chain))
+	node.publishBalance()
+	node.updateWatched()
+	node.restartMining()
+}
+
+/*
+ * Mempool Management Notes:
+ *
+ * 1. Chain-State Consistency:
+ *    - Transactions are validated against the UTXO set on arrival
+ *    - Connecting a block drops its transactions and their conflicts
+ *    - A reorg re-admits the transactions of the dropped blocks
+ *
+ * 2. Real-World Mempool Constraints:
+ *    - Retention: Transactions expire after mempool.DEFAULT_EXPIRY
+ *    - Capacity: mempool.DEFAULT_MAX_SIZE bytes (evicts lowest fee-rate tx when full)
+ *    - Replacement: A conflicting spend must pay more (see Mempool.ValidateReplacement)
+ *
+ * 3. Transaction Security:
+ *    - To prevent malicious replays of stale transactions:
+ *      a) Senders should use nSequence-based RBF to invalidate old versions
+ *      b) Alternatively, spend the same UTXOs in a new transaction
+ *
+ * 4. Confirmation Acceleration:
+ *    - For legitimate stuck transactions:
+ *      a) CPFP: Attach high-fee child transaction
+ *      b) Direct replacement: Increase fee with RBF
+ */
+
+// handleTransaction processes an incoming transaction by:
+// 1. Validating the transaction
+// 2. Checking for duplicates
+// 3. Adding to mempool if valid against the UTXO set
+// Returns error if transaction is invalid or duplicate
+func (node *Node) handleTransaction(txn c.RegularTransaction) error {
+	if err := txn.Validate(); err != nil {
+		node.metrics.failures.With("invalid_tx").Inc()
+		return err
+	}
+
+	txId := txn.TxId
+	_, ok := node.txIds[txId]
+	if ok {
+		return fmt.Errorf("duplicate found")
+	}
+	node.txIds[txId] = struct{}{}
+	node.collector.txSeen(txId)
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if err := node.protected.mempool.Add(txn, &node.protected.utxoDb); err != nil {
+		node.metrics.failures.With("mempool").Inc()
+		return err
+	}
+	return nil
+}
+
+// handleMinedBlock processes a newly mined block by:
+// 1. Appending it to the chain
+// 2. Connecting it to the UTXO database
+// It does not try to rebuild the chain
+func (node *Node) handleMinedBlock(b c.Block) error {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if err := node.protected.chain.ValidateNextBlock(&b, node.sched); err != nil {
+		node.metrics.staleBlocks.Inc()
+		return err
+	}
+	if err := node.connectBlock(&b); err != nil {
+		node.metrics.failures.With("invalid_utxo").Inc()
+		return err
+	}
+	node.blocks[b.BlockHash] = b
+	node.collector.blockStored(b.BlockHash)
+	node.metrics.minedBlocks.Inc()
+	return nil
+}
+
+// receiveBlock handles a block from a peer and relays it if valid.
+// The ancestors of an orphan are requested from the peer.
+func (node *Node) receiveBlock(from *Node, b c.Block, gamma float64, prov Provenance) {
+	node.metrics.messagesIn.With("block").Inc()
+	node.arrive("block", b.BlockHash, BLOCK_HEADER_SIZE+b.Data.Size(), from, prov)
+	node.record(TRACE_BLOCK, from, gamma, []c.Block{b}, nil)
+	switch err := node.handleBlock(b, gamma); {
+	case err == nil:
+		node.broadcastBlock(b, gamma)
+	case errors.Is(err, errOrphan):
+		node.requestBlocks(from, b.BlockHash)
+	}
+	if node.agent != nil {
+		node.agent.tipChanged(node)
+	}
+}
+
+// requestBlocks asks from for the block with hash and the ancestors
+// of it that are not in the chain of node
+func (node *Node) requestBlocks(from *Node, hash util.Hash) {
+	p := node.peer(from)
+	if p == nil {
+		return
+	}
+	node.mu.Lock()
+	locator := make(map[util.Hash]struct{}, len(node.protected.chain))
+	for _, b := range node.protected.chain {
+		locator[b.BlockHash] = struct{}{}
+	}
+	node.mu.Unlock()
+	node.send(p, "getblocks", HASH_SIZE*(len(locator)+1), func() {
+		from.sendBlocks(node, hash, locator)
+	})
+}
+
+// sendBlocks replies to requestBlocks with the ancestors of the block with hash
+// up to the first in locator, oldest first, in a single message
+func (node *Node) sendBlocks(to *Node, hash util.Hash, locator map[util.Hash]struct{}) {
+	node.metrics.messagesIn.With("getblocks").Inc()
+	p := node.peer(to)
+	if p == nil {
+		return
+	}
+	var blocks []c.Block
+	var provs []Provenance
+	size := 0
+	for {
+		b, ok := node.blocks[hash]
+		if !ok {
+			break
+		}
+		blocks = append(blocks, b)
+		provs = append(provs, node.forward(hash))
+		size += BLOCK_HEADER_SIZE + b.Data.Size()
+		if _, ok := locator[b.BlockHeader.PrevHash]; ok || b.BlockHeader.Index == 0 {
+			break
+		}
+		hash = b.BlockHeader.PrevHash
+	}
+	if len(blocks) == 0 {
+		return
+	}
+	slices.Reverse(blocks)
+	slices.Reverse(provs)
+	node.send(p, "blocks", size, func() { to.receiveBlocks(node, blocks, provs) })
+}
+
+// receiveBlocks handles the reply to requestBlocks and relays the last block
+func (node *Node) receiveBlocks(from *Node, blocks []c.Block, provs []Provenance) {
+	node.metrics.messagesIn.With("blocks").Inc()
+	node.record(TRACE_BLOCKS, from, 0, blocks, nil)
+	var err error
+	for i, b := range blocks {
+		node.arrive("blocks", b.BlockHash, BLOCK_HEADER_SIZE+b.Data.Size(), from, provs[i])
+		err = node.handleBlock(b, 0)
+	}
+	if err == nil {
+		node.broadcastBlock(*util.Last(blocks), 0)
+	}
+	if node.agent != nil {
+		node.agent.tipChanged(node)
+	}
+}
+
+// receiveTransaction handles a transaction from a peer and relays it if valid
+func (node *Node) receiveTransaction(from *Node, txn c.RegularTransaction, prov Provenance) {
+	node.metrics.messagesIn.With("tx").Inc()
+	node.arrive("tx", txn.TxId, txn.Size(), from, prov)
+	node.record(TRACE_TX, from, 0, nil, &txn)
+	node.relayTransaction(txn)
+}
+
+// submitTransaction handles a transaction node made and relays it if valid
+func (node *Node) submitTransaction(txn c.RegularTransaction) {
+	node.record(TRACE_TX, node, 0, nil, &txn)
+	node.originate("tx", txn.TxId, txn.Size())
+	node.relayTransaction(txn)
+}
+
+func (node *Node) relayTransaction(txn c.RegularTransaction) {
+	if err := node.handleTransaction(txn); err == nil {
+		node.broadcastTransaction(txn)
+	}
+}
+
+func (node *Node) makeSimulatedTransaction(nodes []*Node) (*c.RegularTransaction, error) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	// Unconfirmed change can be spent right away
+	view := node.protected.mempool.View(&node.protected.utxoDb)
+	address := node.wallet.GetAddress()
+	workload := &node.scenario.Workload
+	if funds, _ := node.wallet.AvailableFunds(view); funds <= workload.MaxAmount {
+		return nil, fmt.Errorf("%s out of funds", address)
+	}
+
+	recvNode := nodes[node.rd.IntN(len(nodes))]
+	amount := 1 + node.rd.Uint64N(workload.MaxAmount)
+
+	recvAddress := recvNode.wallet.GetAddress()
+
+	// Fall back to workload.Fee until enough blocks are seen to estimate fees
+	pool := &node.protected.mempool
+	if workload.FeeTarget != 0 {
+		if txn, err := node.wallet.MakeRegularTransactionForTarget(view, pool, recvAddress, amount, workload.FeeTarget, node.sched); err == nil {
+			return txn, nil
+		}
+	}
+	return node.wallet.MakeRegularTransaction(view, recvAddress, amount, workload.Fee, node.sched)
+}
+
+// Sim schedules the transfers of the node by:
+// 1. Waiting a random delay in [MinInterval, MaxInterval)
+// 2. Creating a simulated transaction to a random node
+// 3. Relaying it to the peers
+func (node *Node) Sim(nodes []*Node) {
+	workload := &node.scenario.Workload
+	delay := time.Duration(workload.MinInterval)
+	if spread := time.Duration(workload.MaxInterval - workload.MinInterval); spread > 0 {
+		delay += time.Duration(node.rd.Int64N(int64(spread)))
+	}
+	node.sched.After(delay, func() {
+		if txn, err := node.makeSimulatedTransaction(nodes); err == nil {
+			node.submitTransaction(*txn)
+		}
+		node.Sim(nodes)
+	})
+}
@@ -0,0 +1,172 @@
+package sim
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"slices"
+
+	"gcoin/util"
+)
+
+// Provenance travels with every block and transaction a node relays
+type Provenance struct {
+	Origin     int      // Node that mined, published or made it
+	OriginTime Duration // When it left the origin
+	Hops       int      // Links it took to arrive, 0 at the origin
+}
+
+// Arrival is a block or transaction delivered to node To, in order of delivery
+type Arrival struct {
+	Time Duration
+	Kind string    // Of the message, "block", "blocks" in reply to getblocks, or "tx"
+	Hash util.Hash // Of the block, or the TxId
+	From int       // To itself at the origin
+	To   int
+	Size int // Bytes of the item in the message
+	Provenance
+	Duplicate bool // Seen by To before
+}
+
+// originate logs the item with hash as first seen at node, which relays it
+func (node *Node) originate(kind string, hash util.Hash, size int) {
+	node.arrive(kind, hash, size, node, Provenance{Origin: node.id, OriginTime: Duration(node.sched.Elapsed())})
+}
+
+// arrive logs the item with hash delivered from a peer, or node itself at
+// its origin, keeping the Provenance of its first arrival
+func (node *Node) arrive(kind string, hash util.Hash, size int, from *Node, prov Provenance) {
+	_, duplicate := node.seen[hash]
+	if !duplicate {
+		node.seen[hash] = prov
+	}
+	node.arrivals = append(node.arrivals, Arrival{
+		Time:       Duration(node.sched.Elapsed()),
+		Kind:       kind,
+		Hash:       hash,
+		From:       from.id,
+		To:         node.id,
+		Size:       size,
+		Provenance: prov,
+		Duplicate:  duplicate})
+}
+
+// forward is the Provenance of the item with hash as node relays it
+func (node *Node) forward(hash util.Hash) Provenance {
+	prov := node.seen[hash]
+	prov.Hops++
+	return prov
+}
+
+// Hop is the first arrival of an item at a node of a PropagationTree
+type Hop struct {
+	Node   int
+	Parent int // Node it first arrived from, -1 at the origin
+	Hops   int
+	Time   Duration
+	Delay  Duration // From the first arrival at Parent, to spot slow links
+}
+
+// PropagationTree is how a block or transaction spread from its origin,
+// along the first arrival at each node
+type PropagationTree struct {
+	Kind       string // "block" or "tx"
+	Hash       util.Hash
+	Origin     int
+	OriginTime Duration
+	Hops       []Hop // By time of first arrival
+	Duplicates int   // Arrivals at nodes that had seen it before
+}
+
+// Propagation rebuilds the PropagationTree of every block and transaction
+// from the arrivals logged by the nodes, by time of origin
+func (sim *Simulation) Propagation() []PropagationTree {
+	trees := make(map[util.Hash]*PropagationTree)
+	for _, node := range sim.Nodes {
+		for _, arrival := range node.arrivals {
+			tree, ok := trees[arrival.Hash]
+			if !ok {
+				tree = &PropagationTree{Kind: "block", Hash: arrival.Hash, Origin: arrival.Origin, OriginTime: arrival.OriginTime}
+				if arrival.Kind == "tx" {
+					tree.Kind = "tx"
+				}
+				trees[arrival.Hash] = tree
+			}
+			if arrival.Duplicate {
+				tree.Duplicates++
+				continue
+			}
+			hop := Hop{Node: arrival.To, Parent: arrival.From, Hops: arrival.Hops, Time: arrival.Time}
+			if arrival.From == arrival.To {
+				hop.Parent = -1
+			}
+			tree.Hops = append(tree.Hops, hop)
+		}
+	}
+
+	var sorted []PropagationTree
+	for _, tree := range trees {
+		slices.SortStableFunc(tree.Hops, func(a Hop, b Hop) int { return cmp.Compare(a.Time, b.Time) })
+		first := make(map[int]Duration, len(tree.Hops))
+		for _, hop := range tree.Hops {
+			first[hop.Node] = hop.Time
+		}
+		for i, hop := range tree.Hops {
+			if at, ok := first[hop.Parent]; ok {
+				tree.Hops[i].Delay = hop.Time - at
+			}
+		}
+		sorted = append(sorted, *tree)
+	}
+	slices.SortFunc(sorted, func(a PropagationTree, b PropagationTree) int {
+		return cmp.Or(cmp.Compare(a.OriginTime, b.OriginTime), bytes.Compare(a.Hash[:], b.Hash[:]))
+	})
+	return sorted
+}
+
+// WritePropagation writes the PropagationTrees of sim as lines of JSON
+func (sim *Simulation) WritePropagation(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, tree := range sim.Propagation() {
+		if err := enc.Encode(tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redundancy is the overhead of a kind of message, of which "block" and "tx"
+// are flooded to every peer and "blocks" sent to catch up a peer
+type Redundancy struct {
+	Kind           string
+	Deliveries     int     // Arrivals from peers
+	Duplicates     int     // Of Deliveries, of items seen before
+	Overhead       float64 // Duplicates per first arrival from a peer
+	DuplicateBytes int
+}
+
+// redundancies adds up the arrivals logged by nodes for each kind
+func redundancies(nodes []*Node) []Redundancy {
+	var redundancies []Redundancy
+	for _, kind := range []string{"block", "tx", "blocks"} {
+		redundancy := Redundancy{Kind: kind}
+		for _, node := range nodes {
+			for _, arrival := range node.arrivals {
+				if arrival.Kind != kind || arrival.From == arrival.To {
+					continue
+				}
+				redundancy.Deliveries++
+				if arrival.Duplicate {
+					redundancy.Duplicates++
+					redundancy.DuplicateBytes += arrival.Size
+				}
+			}
+		}
+		if first := redundancy.Deliveries - redundancy.Duplicates; first != 0 {
+			redundancy.Overhead = float64(redundancy.Duplicates) / float64(first)
+		}
+		redundancies = append(redundancies, redundancy)
+	}
+	return redundancies
+}
@@ -0,0 +1,269 @@
+package sim
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+const SAMPLE_INTERVAL = time.Second // Between two rows of Report.Series
+
+// Distribution summarizes durations by nearest-rank percentiles
+type Distribution struct {
+	Count int
+	Mean  Duration
+	Min   Duration
+	P50   Duration
+	P90   Duration
+	P99   Duration
+	Max   Duration
+}
+
+func newDistribution(durations []time.Duration) Distribution {
+	if len(durations) == 0 {
+		return Distribution{}
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	percentile := func(p int) Duration {
+		return Duration(sorted[max(0, (p*len(sorted)+99)/100-1)])
+	}
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	return Distribution{
+		Count: len(sorted),
+		Mean:  Duration(sum / time.Duration(len(sorted))),
+		Min:   Duration(sorted[0]),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   Duration(*util.Last(sorted))}
+}
+
+// Revenue compares the share of the coinbase amounts of the main chain
+// a node earned after Scenario.Warmup with its share of the hash power
+type Revenue struct {
+	Node         int
+	Amount       uint64
+	HashShare    float64
+	RevenueShare float64
+}
+
+// ForkDepth is a bucket of Report.ForkDepths
+type ForkDepth struct {
+	Depth  int // Blocks disconnected
+	Reorgs int
+}
+
+// Sample is a row of Report.Series
+type Sample struct {
+	Time        Duration
+	Height      int     // Of the longest chain among the nodes
+	Mempool     float64 // Transactions in the mempool of a node, on average
+	MempoolMax  int
+	MempoolSize float64 // Bytes in the mempool of a node, on average
+	Blocks      int     // Stored by a node so far, stale ones included
+	Reorgs      int     // Across the nodes so far
+}
+
+/*
+ * Report measures a run from the time every node first stored each block
+ * and transaction, so the latencies include mining but not the grinding
+ * of the proof of work, which takes no virtual time.
+ *
+ * Only the main chain blocks after Scenario.Warmup are measured for block
+ * intervals, confirmations and revenue, as the difficulty settles before.
+ */
+type Report struct {
+	BlockInterval       Distribution // Between the first sight of consecutive main chain blocks
+	StaleRate           float64      // Of the blocks stored by a node, those off the main chain
+	BlockPropagation    Distribution // From the first node storing a block to each other
+	TxPropagation       Distribution // From the first node seeing a transaction to each other
+	ForkDepths          []ForkDepth  // Reorgs across the nodes, by increasing depth
+	ConfirmationLatency Distribution // From the first sight of a transaction to that of its main chain block
+	Revenues            []Revenue
+	Fairness            float64      // Jain's index of RevenueShare / HashShare, 1 when every miner earns its share
+	Redundancy          []Redundancy // Duplicate deliveries, by kind of message
+	Series              []Sample
+}
+
+// collector records what the nodes of a Simulation see, for its Report
+type collector struct {
+	sim         *Simulation
+	blockFirst  map[util.Hash]time.Duration // Elapsed when a node first stored the block
+	blockDelays []time.Duration
+	txFirst     map[c.TxId]time.Duration // Elapsed when a node first saw the transaction
+	txDelays    []time.Duration
+	forkDepths  map[int]int
+	reorgs      int
+	series      []Sample
+}
+
+func newCollector(sim *Simulation) *collector {
+	return &collector{
+		sim:        sim,
+		blockFirst: make(map[util.Hash]time.Duration),
+		txFirst:    make(map[c.TxId]time.Duration),
+		forkDepths: make(map[int]int)}
+}
+
+// blockStored is called once by every node storing the block with hash.
+// A nil collector, for a node outside a Simulation, records nothing.
+func (col *collector) blockStored(hash util.Hash) {
+	if col == nil {
+		return
+	}
+	now := col.sim.Scheduler.Elapsed()
+	if first, ok := col.blockFirst[hash]; ok {
+		col.blockDelays = append(col.blockDelays, now-first)
+	} else {
+		col.blockFirst[hash] = now
+	}
+}
+
+// txSeen is called once by every node seeing the transaction with txId
+func (col *collector) txSeen(txId c.TxId) {
+	if col == nil {
+		return
+	}
+	now := col.sim.Scheduler.Elapsed()
+	if first, ok := col.txFirst[txId]; ok {
+		col.txDelays = append(col.txDelays, now-first)
+	} else {
+		col.txFirst[txId] = now
+	}
+}
+
+// reorg is called by a node disconnecting depth blocks
+func (col *collector) reorg(depth int) {
+	if col == nil {
+		return
+	}
+	col.forkDepths[depth]++
+	col.reorgs++
+}
+
+// sample appends a row to the series every SAMPLE_INTERVAL
+func (col *collector) sample() {
+	sample := Sample{Time: Duration(col.sim.Scheduler.Elapsed()), Blocks: len(col.blockFirst), Reorgs: col.reorgs}
+	for _, node := range col.sim.Nodes {
+		node.mu.Lock()
+		sample.Height = max(sample.Height, len(node.protected.chain)-1)
+		sample.Mempool += float64(node.protected.mempool.Len())
+		sample.MempoolMax = max(sample.MempoolMax, node.protected.mempool.Len())
+		sample.MempoolSize += float64(node.protected.mempool.Size())
+		node.mu.Unlock()
+	}
+	sample.Mempool /= float64(len(col.sim.Nodes))
+	sample.MempoolSize /= float64(len(col.sim.Nodes))
+	col.series = append(col.series, sample)
+	col.sim.Scheduler.After(SAMPLE_INTERVAL, col.sample)
+}
+
+// report measures the run against main
+func (col *collector) report(main c.Chain) Report {
+	report := Report{
+		BlockPropagation: newDistribution(col.blockDelays),
+		TxPropagation:    newDistribution(col.txDelays),
+		Redundancy:       redundancies(col.sim.Nodes),
+		Series:           col.series}
+	for depth, reorgs := range col.forkDepths {
+		report.ForkDepths = append(report.ForkDepths, ForkDepth{Depth: depth, Reorgs: reorgs})
+	}
+	slices.SortFunc(report.ForkDepths, func(a ForkDepth, b ForkDepth) int { return a.Depth - b.Depth })
+	if len(col.blockFirst) != 0 {
+		report.StaleRate = float64(len(col.blockFirst)-len(main)) / float64(len(col.blockFirst))
+	}
+
+	warmup := time.Duration(col.sim.Scenario.Warmup)
+	var intervals, latencies []time.Duration
+	amounts := make(map[c.Address]uint64)
+	var total uint64
+	for i, b := range main {
+		seen := col.blockFirst[b.BlockHash]
+		if seen < warmup {
+			continue
+		}
+		if i > 0 {
+			intervals = append(intervals, seen-col.blockFirst[main[i-1].BlockHash])
+		}
+		for _, txn := range b.Data.RTxns {
+			if first, ok := col.txFirst[txn.TxId]; ok {
+				latencies = append(latencies, seen-first)
+			}
+		}
+		if out, ok := reward(&b); ok {
+			amounts[out.Address] += out.Amount
+			total += out.Amount
+		}
+	}
+	report.BlockInterval = newDistribution(intervals)
+	report.ConfirmationLatency = newDistribution(latencies)
+
+	var hashRate float64
+	for _, node := range col.sim.Nodes {
+		hashRate += node.hashRate
+	}
+	var sum, squares float64
+	for i, node := range col.sim.Nodes {
+		revenue := Revenue{Node: i, Amount: amounts[node.Address()], HashShare: node.hashRate / hashRate}
+		if total != 0 {
+			revenue.RevenueShare = float64(revenue.Amount) / float64(total)
+		}
+		ratio := revenue.RevenueShare / revenue.HashShare
+		sum += ratio
+		squares += ratio * ratio
+		report.Revenues = append(report.Revenues, revenue)
+	}
+	if squares != 0 {
+		report.Fairness = sum * sum / (float64(len(col.sim.Nodes)) * squares)
+	}
+	return report
+}
+
+// reward is the output of the coinbase of b, which blocks stored before
+// they are validated may lack
+func reward(b *c.Block) (c.TxOut, bool) {
+	txOuts := b.Data.CTxn.TxData.TxOuts
+	if len(txOuts) != 1 {
+		return c.TxOut{}, false
+	}
+	return txOuts[0], true
+}
+
+// WriteJSON writes report as indented JSON
+func (report *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(report)
+}
+
+// WriteCSV writes report.Series with a header row, times in seconds
+func (report *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "height", "mempool", "mempool_max", "mempool_size", "blocks", "reorgs"})
+	for _, sample := range report.Series {
+		cw.Write([]string{
+			strconv.FormatFloat(time.Duration(sample.Time).Seconds(), 'f', 3, 64),
+			strconv.Itoa(sample.Height),
+			strconv.FormatFloat(sample.Mempool, 'f', 2, 64),
+			strconv.Itoa(sample.MempoolMax),
+			strconv.FormatFloat(sample.MempoolSize, 'f', 0, 64),
+			strconv.Itoa(sample.Blocks),
+			strconv.Itoa(sample.Reorgs)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Duration is a time.Duration written as a string such as "30s" in JSON
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Workload is the transfers every node makes to random nodes
+type Workload struct {
+	MinInterval Duration // Between two transfers of a node
+	MaxInterval Duration
+	MaxAmount   uint64 // Amounts are drawn from [1, MaxAmount]
+	Fee         uint64 // Paid without a fee estimate
+	FeeTarget   uint64 // Blocks a transfer should confirm within, 0 to always pay Fee
+}
+
+const DEFAULT_HASH_RATE = 2000 // Hashes per second of the nodes without a hash rate
+
+type Scenario struct {
+	Nodes      int
+	Topology   Topology
+	HashRates  []float64  // Hashes per second of node i, 0 or missing for DEFAULT_HASH_RATE
+	Link       Link       // Between every two peers
+	Links      []PeerLink // Except these
+	Partitions []Partition
+	Strategies []Strategy // Of the nodes that are not honest
+	Eclipses   []Eclipse
+	Warmup     Duration // Blocks mined before are left out of the AttackResult shares, as the difficulty settles
+	Workload   Workload
+	Duration   Duration // In virtual time
+	Seed       uint64   // Of the random choices of the nodes, the same seed replays the same run
+	Index      bool     // Maintain the transaction and address indexes
+}
+
+// DefaultScenario is two groups of 4 nodes, each connected to the other group
+func DefaultScenario() Scenario {
+	return Scenario{
+		Nodes:    8,
+		Topology: Topology{Kind: TOPOLOGY_BIPARTITE},
+		Link:     Link{Latency: Duration(50 * time.Millisecond)},
+		Workload: Workload{
+			MinInterval: Duration(100 * time.Millisecond),
+			MaxInterval: Duration(time.Second),
+			MaxAmount:   5,
+			Fee:         1,
+			FeeTarget:   3},
+		Duration: Duration(25 * time.Second),
+		Seed:     42}
+}
+
+// LoadScenario reads a JSON scenario, omitted fields take their value in DefaultScenario
+func LoadScenario(path string) (Scenario, error) {
+	scenario := DefaultScenario()
+	f, err := os.Open(path)
+	if err != nil {
+		return scenario, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&scenario); err != nil {
+		return scenario, fmt.Errorf("%s: %w", path, err)
+	}
+	if p := scenario.Topology.Path; p != "" && !filepath.IsAbs(p) {
+		scenario.Topology.Path = filepath.Join(filepath.Dir(path), p)
+	}
+	return scenario, scenario.Validate()
+}
+
+func (scenario *Scenario) Validate() error {
+	if scenario.Nodes < 1 {
+		return fmt.Errorf("%d nodes", scenario.Nodes)
+	}
+	if len(scenario.HashRates) > scenario.Nodes {
+		return fmt.Errorf("%d hash rates for %d nodes", len(scenario.HashRates), scenario.Nodes)
+	}
+	for i, hashRate := range scenario.HashRates {
+		if hashRate < 0 {
+			return fmt.Errorf("negative hash rate of node %d", i)
+		}
+	}
+	if err := scenario.Link.Validate(); err != nil {
+		return err
+	}
+	for i := range scenario.Partitions {
+		if err := scenario.Partitions[i].Validate(scenario.Nodes); err != nil {
+			return err
+		}
+	}
+	for i := range scenario.Strategies {
+		strategy := &scenario.Strategies[i]
+		if err := strategy.Validate(scenario.Nodes); err != nil {
+			return err
+		}
+		if slices.ContainsFunc(scenario.Strategies[:i], func(other Strategy) bool { return other.Node == strategy.Node }) {
+			return fmt.Errorf("node %d has two strategies", strategy.Node)
+		}
+	}
+	for i := range scenario.Eclipses {
+		eclipse := &scenario.Eclipses[i]
+		if err := eclipse.Validate(scenario.Nodes); err != nil {
+			return err
+		}
+		if slices.ContainsFunc(scenario.Eclipses[:i], func(other Eclipse) bool { return other.Victim == eclipse.Victim }) {
+			return fmt.Errorf("node %d eclipsed twice", eclipse.Victim)
+		}
+	}
+	workload := &scenario.Workload
+	if workload.MinInterval <= 0 || workload.MaxInterval < workload.MinInterval {
+		return fmt.Errorf("interval [%v, %v] invalid", workload.MinInterval, workload.MaxInterval)
+	}
+	if workload.MaxAmount == 0 {
+		return fmt.Errorf("MaxAmount is 0")
+	}
+	if scenario.Duration <= 0 {
+		return fmt.Errorf("duration %v not positive", time.Duration(scenario.Duration))
+	}
+	if scenario.Warmup < 0 || scenario.Warmup >= scenario.Duration {
+		return fmt.Errorf("warmup %v not in [0, %v)", time.Duration(scenario.Warmup), time.Duration(scenario.Duration))
+	}
+	peers, err := scenario.Topology.Graph(scenario.Nodes, scenario.Seed)
+	if err != nil {
+		return err
+	}
+	for _, peerLink := range scenario.Links {
+		i, j := peerLink.Nodes[0], peerLink.Nodes[1]
+		if i < 0 || i >= scenario.Nodes || !slices.Contains(peers[i], j) {
+			return fmt.Errorf("nodes %d and %d not peers", i, j)
+		}
+		if err := peerLink.Link.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkOf is the link between peers i and j
+func (scenario *Scenario) LinkOf(i int, j int) Link {
+	for _, peerLink := range scenario.Links {
+		if peerLink.Nodes == [2]int{i, j} || peerLink.Nodes == [2]int{j, i} {
+			return peerLink.Link
+		}
+	}
+	return scenario.Link
+}
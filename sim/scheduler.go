@@ -0,0 +1,91 @@
+package sim
+
+import (
+	"container/heap"
+	"time"
+)
+
+const EPOCH = 1_700_000_000_000 // Unix milliseconds at which virtual time starts
+
+type event struct {
+	at  time.Duration // Since EPOCH
+	seq uint64        // Breaks ties in the order events are scheduled
+	f   func()
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i int, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q eventQueue) Swap(i int, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) { *q = append(*q, x.(event)) }
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+/*
+ * Scheduler runs events one at a time in virtual time.
+ *
+ * Events at the same time run in the order they were scheduled, so a
+ * simulation whose events only draw from seeded sources replays
+ * identically. Time does not pass while an event runs: mining, relaying
+ * and validating take no virtual time unless they schedule their
+ * outcome later. The Scheduler is the util.Clock of the nodes and is
+ * not safe for concurrent use.
+ */
+type Scheduler struct {
+	now      time.Duration
+	seq      uint64
+	queue    eventQueue
+	Realtime bool // Wait for the wall clock to catch up before each event
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Now implements util.Clock
+func (sched *Scheduler) Now() int64 {
+	return EPOCH + sched.now.Milliseconds()
+}
+
+// Elapsed is the virtual time since EPOCH
+func (sched *Scheduler) Elapsed() time.Duration {
+	return sched.now
+}
+
+// After schedules f to run d from now
+func (sched *Scheduler) After(d time.Duration, f func()) {
+	sched.seq++
+	heap.Push(&sched.queue, event{at: sched.now + max(d, 0), seq: sched.seq, f: f})
+}
+
+// RunUntil runs the events up to end, then leaves the clock at end
+func (sched *Scheduler) RunUntil(end time.Duration) {
+	start := time.Now().Add(-sched.now)
+	wait := func(at time.Duration) {
+		if sched.Realtime {
+			<-time.After(time.Until(start.Add(at)))
+		}
+	}
+	for len(sched.queue) != 0 && sched.queue[0].at <= end {
+		e := heap.Pop(&sched.queue).(event)
+		wait(e.at)
+		sched.now = e.at
+		e.f()
+	}
+	wait(end)
+	sched.now = end
+}
@@ -0,0 +1,241 @@
+// Package sim runs a decentralized blockchain network of nodes as
+// described by a Scenario. Key characteristics of the simulation:
+//
+// 1. Consensus:
+//   - Final blockchain states across nodes may differ due to:
+//   - Natural blockchain forks during simulation
+//   - Network latency in block propagation
+//   - Variation in mining speeds between nodes
+//   - However, chains should converge up to a common prefix due to:
+//   - The longest valid chain rule
+//   - Eventually consistent gossip protocol
+//   - Automatic chain reorganization logic
+//
+// 2. Integrity:
+//   - Messages take the latency of their Link, queue for its bandwidth and may
+//     be lost, so they are neither reliable nor causal, nor FIFO with jitter.
+//   - A node missing the ancestors of a block requests them from the peer
+//     that relayed it, which also reconciles the groups of a healed Partition
+//   - Each node has to be validating and rebuild the chain upon reorg
+//     to recover the causal order of events
+//
+// 3. Network Topology:
+//   - Nodes relay blocks and transactions to their peers in the Topology,
+//     such as two groups with every node connected to the opposite group,
+//     or a random, small-world or scale-free graph drawn from Scenario.Seed
+//   - This models real-world P2P networks where:
+//   - Not all nodes connect to each other directly
+//   - Network partitions can occur temporarily, as scheduled by Scenario.Partitions
+//   - Sybils can take over the peers of a victim to hide blocks from it,
+//     as scheduled by Scenario.Eclipses
+//   - Messages propagate through gossip protocol
+//
+// 4. Determinism:
+//   - A Scheduler runs the events of all nodes one at a time in virtual time,
+//     which is also the clock blocks and transactions are stamped with
+//   - Finding a block takes as long as 2^Target hashes on average at the hash
+//     rate of the miner, and only found blocks are ground for their proof of
+//     work, so a run takes far less than Scenario.Duration of wall-clock time
+//   - Wallets, signatures and random choices derive from Scenario.Seed,
+//     so the same scenario replays the same chains
+//
+// 5. Simulation Output:
+//   - A Result with the tip of every node and whether their chains converged
+//     up to a common prefix, with UTXO sets true to their chains (for consensus analysis)
+//   - A Report of block intervals, stale blocks, propagation and confirmation
+//     delays, fork depths and miner revenue, with a time series of the mempools
+//     that Report.WriteCSV writes
+//   - The share of the main chain mined by each node with a Strategy, such as
+//     a selfish miner, against its share of the hash power
+//   - For a double spender, the fraction of payments reversed after each number
+//     of confirmations, which Sweep estimates across hash shares
+//   - For the victim of an eclipse, the time spent on a stale tip and the
+//     blocks mined on the fork the Sybils fed it
+//   - The origin and hop count every block and transaction carries, from
+//     which Simulation.Propagation rebuilds the tree it spread along, and the
+//     duplicates the flooding broadcast delivers
+//   - The full chains and UTXO sets stay available from Simulation.Nodes
+package sim
+
+import (
+	"slices"
+	"time"
+
+	c "gcoin/currency"
+	"gcoin/topology"
+	"gcoin/util"
+)
+
+type Simulation struct {
+	Scenario  Scenario
+	Scheduler *Scheduler
+	Graph     topology.Graph // Node i relays to Nodes[j] for j in Graph[i]
+	Nodes     []*Node
+	eclipses  []*eclipse
+	collector *collector
+}
+
+// NewSimulation creates and connects the nodes of scenario
+func NewSimulation(scenario Scenario) (*Simulation, error) {
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+	graph, err := scenario.Topology.Graph(scenario.Nodes, scenario.Seed)
+	if err != nil {
+		return nil, err
+	}
+	sim := &Simulation{Scenario: scenario, Scheduler: NewScheduler(), Graph: graph}
+	sim.collector = newCollector(sim)
+	for i := range scenario.Nodes {
+		node := NewNode(i, &sim.Scenario, sim.Scheduler)
+		node.collector = sim.collector
+		sim.Nodes = append(sim.Nodes, node)
+	}
+	for i, node := range sim.Nodes {
+		for _, j := range graph[i] {
+			node.connect(sim.Nodes[j], scenario.LinkOf(i, j))
+		}
+	}
+	for _, strategy := range sim.Scenario.Strategies {
+		sim.Nodes[strategy.Node].agent = newAgent(strategy, sim.Nodes)
+	}
+	for _, e := range sim.Scenario.Eclipses {
+		sim.eclipses = append(sim.eclipses, newEclipse(sim, e))
+	}
+	return sim, nil
+}
+
+type NodeResult struct {
+	Address     c.Address
+	Height      uint64
+	TipHash     util.Hash
+	Diff        uint64
+	BlocksMined uint64
+	StaleBlocks uint64 // Mined on a stale tip or dropped by a reorg
+	MempoolLen  int
+}
+
+// AttackResult compares the share of the blocks in the main chain that a
+// node with a Strategy mined after Scenario.Warmup with its share of the
+// hash power. An honest Strategy gives the baseline to compare with.
+type AttackResult struct {
+	Node       int
+	Strategy   string
+	HashShare  float64
+	BlockShare float64
+	Reversals  []Reversal // Of STRATEGY_DOUBLE_SPEND, by confirmations
+}
+
+type Result struct {
+	Elapsed     Duration // Virtual time simulated
+	WallTime    Duration // Taken to simulate it, which varies between runs
+	Topology    topology.Stats
+	Convergence Convergence
+	Nodes       []NodeResult
+	Attacks     []AttackResult
+	Eclipses    []EclipseResult
+	Report      Report
+}
+
+// Run mines, relays and transfers on every node for Scenario.Duration of virtual time
+func (sim *Simulation) Run() Result {
+	start := time.Now()
+	for _, node := range sim.Nodes {
+		node.restartMining()
+		node.Sim(sim.Nodes)
+	}
+	for _, e := range sim.eclipses {
+		e.schedule()
+	}
+	sim.collector.sample()
+	sim.Scheduler.RunUntil(time.Duration(sim.Scenario.Duration))
+	return sim.result(time.Since(start))
+}
+
+func (sim *Simulation) result(wallTime time.Duration) Result {
+	result := Result{
+		Elapsed:  Duration(sim.Scheduler.Elapsed()),
+		WallTime: Duration(wallTime),
+		Topology: sim.Graph.Stats()}
+	for _, node := range sim.Nodes {
+		node.mu.Lock()
+		chain := node.protected.chain
+		nodeResult := NodeResult{
+			Address:     node.Address(),
+			Diff:        chain.Difficulty(),
+			BlocksMined: node.metrics.minedBlocks.Value(),
+			StaleBlocks: node.metrics.staleBlocks.Value(),
+			MempoolLen:  node.protected.mempool.Len()}
+		node.mu.Unlock()
+		if last := util.Last(chain); last != nil {
+			nodeResult.Height = last.BlockHeader.Index
+			nodeResult.TipHash = last.BlockHash
+		}
+		result.Nodes = append(result.Nodes, nodeResult)
+	}
+	result.Convergence = CheckConvergence(sim.Nodes)
+	result.Attacks = sim.attacks()
+	for _, e := range sim.eclipses {
+		eclipse := e.result
+		eclipse.MinedOnFork = e.minedOnFork()
+		result.Eclipses = append(result.Eclipses, eclipse)
+	}
+	result.Report = sim.collector.report(sim.mainChain())
+	return result
+}
+
+// mainChain is the chain of most difficulty among the honest nodes
+// that are not the victim of an eclipse
+func (sim *Simulation) mainChain() c.Chain {
+	var main c.Chain
+	for _, node := range sim.Nodes {
+		if node.agent != nil || slices.ContainsFunc(sim.eclipses, func(e *eclipse) bool { return e.victim == node }) {
+			continue
+		}
+		if chain := node.Chain(); chain.Difficulty() > main.Difficulty() {
+			main = chain
+		}
+	}
+	return main
+}
+
+func (sim *Simulation) attacks() []AttackResult {
+	main := sim.mainChain()
+	var hashRate float64
+	for _, node := range sim.Nodes {
+		hashRate += node.hashRate
+	}
+	var attacks []AttackResult
+	for _, strategy := range sim.Scenario.Strategies {
+		node := sim.Nodes[strategy.Node]
+		attack := AttackResult{Node: strategy.Node, Strategy: strategy.Kind, HashShare: node.hashRate / hashRate}
+		address := node.Address()
+		mined, total := 0, 0
+		for _, b := range main {
+			if b.BlockHeader.Timestamp < EPOCH+time.Duration(sim.Scenario.Warmup).Milliseconds() {
+				continue
+			}
+			total++
+			if out, ok := reward(&b); ok && out.Address == address {
+				mined++
+			}
+		}
+		if total != 0 {
+			attack.BlockShare = float64(mined) / float64(total)
+		}
+		if ds, ok := node.agent.(*doubleSpender); ok {
+			attack.Reversals = ds.reversals(main, attack.HashShare)
+		}
+		attacks = append(attacks, attack)
+	}
+	return attacks
+}
+
+// Run simulates scenario
+func Run(scenario Scenario) (Result, error) {
+	sim, err := NewSimulation(scenario)
+	if err != nil {
+		return Result{}, err
+	}
+	return sim.Run(), nil
+}
@@ -0,0 +1,576 @@
+package sim
+
+import (
+	"bytes"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gcoin/blockchain"
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+func TestScheduler(t *testing.T) {
+	sched := NewScheduler()
+	var order []int
+	sched.After(2*time.Second, func() { order = append(order, 3) })
+	sched.After(time.Second, func() {
+		order = append(order, 1)
+		sched.After(0, func() { order = append(order, 2) })
+	})
+	sched.After(5*time.Second, func() { order = append(order, 4) })
+	sched.RunUntil(3 * time.Second)
+	if !reflect.DeepEqual(order, []int{1, 2, 3}) {
+		t.Errorf("order %v", order)
+	}
+	if sched.Now() != EPOCH+3000 {
+		t.Errorf("now %d", sched.Now())
+	}
+}
+
+func TestTopology(t *testing.T) {
+	degrees := map[string][]int{
+		TOPOLOGY_BIPARTITE: {3, 3, 2, 2, 2},
+		TOPOLOGY_CLIQUE:    {5, 5, 5, 5, 5, 5},
+		TOPOLOGY_RING:      {2, 2, 2, 2, 2, 2},
+	}
+	for kind, want := range degrees {
+		topology := Topology{Kind: kind}
+		peers, err := topology.Graph(len(want), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range peers {
+			if len(p) != want[i] {
+				t.Errorf("%s: node %d has peers %v", kind, i, p)
+			}
+		}
+	}
+	topology := Topology{Kind: "star"}
+	if _, err := topology.Graph(3, 0); err == nil {
+		t.Error("unknown topology accepted")
+	}
+
+	topology = Topology{Kind: TOPOLOGY_REGULAR, Degree: 3}
+	first, err := topology.Graph(10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := topology.Graph(10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Error("same seed, different graphs")
+	}
+}
+
+func TestLink(t *testing.T) {
+	rd := rand.New(rand.NewPCG(1, 2))
+	link := Link{Latency: Duration(100 * time.Millisecond), Jitter: Duration(10 * time.Millisecond), Bandwidth: 1000}
+	if err := link.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if delay := link.delay(rd); delay < 100*time.Millisecond || delay >= 110*time.Millisecond {
+		t.Errorf("delay %v", delay)
+	}
+	if transmission := link.transmission(500); transmission != 500*time.Millisecond {
+		t.Errorf("transmission %v", transmission)
+	}
+	for _, link := range []Link{{Loss: 1.5}, {Distribution: "normal"}, {Bandwidth: -1}} {
+		if err := link.Validate(); err == nil {
+			t.Errorf("link %+v accepted", link)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	partition := Partition{At: Duration(time.Second), Heal: Duration(2 * time.Second), Groups: [][]int{{0, 1}}}
+	if err := partition.Validate(4); err != nil {
+		t.Fatal(err)
+	}
+	if partition.Separates(0, 0, 2) || partition.Separates(2*time.Second, 0, 2) {
+		t.Error("separated outside of the partition")
+	}
+	if !partition.Separates(time.Second, 0, 2) || partition.Separates(time.Second, 0, 1) || partition.Separates(time.Second, 2, 3) {
+		t.Error("groups not separated")
+	}
+	partition.Groups = [][]int{{0, 1}, {1}}
+	if err := partition.Validate(4); err == nil {
+		t.Error("node in two groups accepted")
+	}
+
+	scenario := DefaultScenario()
+	scenario.Nodes = 4
+	scenario.Topology.Kind = TOPOLOGY_CLIQUE
+	scenario.Duration = Duration(6 * time.Second)
+	scenario.Partitions = []Partition{{At: Duration(time.Second), Groups: [][]int{{0, 1}}}}
+	result, err := Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Nodes[0].TipHash == result.Nodes[2].TipHash {
+		t.Error("groups agree while partitioned")
+	}
+
+	// Healed, the groups converge on the chain of either
+	scenario.Partitions[0].Heal = Duration(3 * time.Second)
+	result, err = Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Nodes[0].TipHash != result.Nodes[2].TipHash {
+		t.Errorf("groups disagree once healed %+v", result)
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(path, []byte(`{"Nodes": 3, "Topology": {"Kind": "ring"}, "Duration": "2s"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := LoadScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scenario.Nodes != 3 || scenario.Duration != Duration(2*time.Second) || scenario.Workload != DefaultScenario().Workload {
+		t.Errorf("scenario %+v", scenario)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"Nodes": 3, "Topology": {"Kind": "file", "Path": "edges.txt"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), "edges.txt"), []byte("0 1\n1 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadScenario(path); err != nil {
+		t.Error(err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"Nodes": 2, "HashRates": [1, 2, 3]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadScenario(path); err == nil {
+		t.Error("more hash rates than nodes accepted")
+	}
+	if err := os.WriteFile(path, []byte(`{"Nodez": 2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadScenario(path); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
+
+func TestRun(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Nodes = 2
+	scenario.Topology.Kind = TOPOLOGY_CLIQUE
+	scenario.Duration = Duration(2 * time.Second)
+	result, err := Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Nodes) != 2 || !result.Convergence.Pass || result.Convergence.Height < 0 {
+		t.Errorf("result %+v", result)
+	}
+	var mined uint64
+	for _, node := range result.Nodes {
+		mined += node.BlocksMined
+	}
+	if mined == 0 {
+		t.Error("no block mined")
+	}
+	if result.Elapsed != scenario.Duration {
+		t.Errorf("elapsed %v", result.Elapsed)
+	}
+}
+
+func TestRunDeterministic(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Nodes = 3
+	scenario.Topology.Kind = TOPOLOGY_RING
+	scenario.Duration = Duration(3 * time.Second)
+	first, err := Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first.Convergence, second.Convergence) || !reflect.DeepEqual(first.Nodes, second.Nodes) {
+		t.Errorf("same seed, different results %+v %+v", first, second)
+	}
+
+	scenario.Seed++
+	third, err := Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(first.Nodes, third.Nodes) {
+		t.Error("different seeds, same results")
+	}
+}
+
+func TestSelfishMining(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Nodes = 3
+	scenario.Topology.Kind = TOPOLOGY_CLIQUE
+	scenario.HashRates = []float64{3000, 2000, 2000}
+	scenario.Duration = Duration(8 * time.Second)
+	scenario.Warmup = Duration(4 * time.Second)
+	scenario.Strategies = []Strategy{{Node: 0, Kind: STRATEGY_SELFISH, Gamma: 0.5}}
+	sim, err := NewSimulation(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := sim.Run()
+	if len(result.Attacks) != 1 {
+		t.Fatalf("attacks %+v", result.Attacks)
+	}
+	if attack := result.Attacks[0]; attack.HashShare != 3.0/7 || attack.BlockShare == 0 {
+		t.Errorf("attack %+v", attack)
+	}
+	// The private branch was published, only with blocks the miner found
+	if published := sim.Nodes[0].agent.(*selfishMiner).published; published == 0 || uint64(published) > result.Nodes[0].BlocksMined {
+		t.Errorf("%d of %d mined blocks published", published, result.Nodes[0].BlocksMined)
+	}
+	if !result.Convergence.Pass {
+		t.Errorf("honest nodes diverged: %s", result.Convergence.Reason)
+	}
+
+	scenario.Strategies[0].Gamma = 2
+	if _, err := Run(scenario); err == nil {
+		t.Error("gamma above 1 accepted")
+	}
+}
+
+func TestDoubleSpend(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Nodes = 3
+	scenario.Topology.Kind = TOPOLOGY_CLIQUE
+	scenario.Duration = Duration(20 * time.Second)
+	scenario.Warmup = Duration(5 * time.Second)
+	scenario.Strategies = []Strategy{{Node: 0, Kind: STRATEGY_DOUBLE_SPEND, Merchant: 1, Amount: 3, Confirmations: 1}}
+	attacks, err := Sweep(scenario, 0, []float64{0.6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversals := attacks[0].Reversals
+	if len(reversals) != MAX_CONFIRMATIONS+1 || reversals[1].Reversed == 0 || reversals[1].Nakamoto != 1 {
+		t.Errorf("reversals %+v", reversals)
+	}
+
+	// A weak attacker giving up early lets its payments stand
+	scenario.Strategies[0].GiveUp = 2
+	attacks, err = Sweep(scenario, 0, []float64{0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversal := attacks[0].Reversals[1]; reversal.Payments < 2 || reversal.Reversed != 0 {
+		t.Errorf("reversal %+v", reversal)
+	}
+
+	scenario.Strategies[0].Merchant = 0
+	if _, err := Run(scenario); err == nil {
+		t.Error("attacker paying itself accepted")
+	}
+}
+
+func TestNakamotoProbability(t *testing.T) {
+	// From section 11 of the Bitcoin paper
+	for _, c := range []struct {
+		q    float64
+		z    int
+		want float64
+	}{{0.1, 0, 1}, {0.1, 5, 0.0009137}, {0.3, 5, 0.1773523}, {0.3, 10, 0.0416605}} {
+		if got := NakamotoProbability(c.q, c.z); math.Abs(got-c.want) > 1e-7 {
+			t.Errorf("q=%v z=%d: %v", c.q, c.z, got)
+		}
+	}
+}
+
+func TestEclipse(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Topology.Kind = TOPOLOGY_RING
+	scenario.Duration = Duration(12 * time.Second)
+	scenario.Eclipses = []Eclipse{{
+		Victim:               0,
+		Sybils:               []int{4, 5},
+		At:                   Duration(3 * time.Second),
+		Heal:                 Duration(8 * time.Second),
+		ForkHashRate:         4000,
+		WithholdTransactions: true}}
+	eclipsed, err := Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenario.Eclipses[0].Diversity = 1
+	diverse, err := Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := eclipsed.Eclipses[0]; e.SybilPeers != 2 || e.HonestPeers != 0 || e.MinedOnFork == 0 || e.Recovery < 0 {
+		t.Errorf("eclipsed %+v", e)
+	}
+	if e := diverse.Eclipses[0]; e.HonestPeers != 1 || e.StaleTime >= eclipsed.Eclipses[0].StaleTime {
+		t.Errorf("diverse %+v", e)
+	}
+
+	scenario.Eclipses[0].Sybils = []int{0}
+	if _, err := Run(scenario); err == nil {
+		t.Error("victim among sybils accepted")
+	}
+}
+
+func TestReport(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Duration = Duration(5 * time.Second)
+	scenario.Warmup = Duration(2 * time.Second)
+	result, err := Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := result.Report
+	if report.BlockPropagation.Count == 0 || report.BlockPropagation.Min < Duration(50*time.Millisecond) {
+		t.Errorf("block propagation %+v", report.BlockPropagation)
+	}
+	if report.TxPropagation.Count == 0 || report.ConfirmationLatency.Count == 0 || report.BlockInterval.Count == 0 {
+		t.Errorf("report %+v", report)
+	}
+	if report.StaleRate < 0 || report.StaleRate >= 1 || report.Fairness <= 0 || report.Fairness > 1 {
+		t.Errorf("stale rate %v, fairness %v", report.StaleRate, report.Fairness)
+	}
+	if len(report.Revenues) != scenario.Nodes || len(report.Series) != 6 {
+		t.Errorf("%d revenues, %d samples", len(report.Revenues), len(report.Series))
+	}
+
+	var csv bytes.Buffer
+	if err := report.WriteCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(csv.String()), "\n"); len(lines) != 7 || lines[0] != "time,height,mempool,mempool_max,mempool_size,blocks,reorgs" {
+		t.Errorf("csv %q", lines)
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	var durations []time.Duration
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	d := newDistribution(durations)
+	if d.Count != 100 || d.Min != Duration(time.Millisecond) || d.P50 != Duration(50*time.Millisecond) ||
+		d.P99 != Duration(99*time.Millisecond) || d.Max != Duration(100*time.Millisecond) {
+		t.Errorf("distribution %+v", d)
+	}
+}
+
+func TestConvergence(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Nodes = 4
+	scenario.Topology.Kind = TOPOLOGY_CLIQUE
+	scenario.Duration = Duration(8 * time.Second)
+	scenario.Partitions = []Partition{{At: Duration(2 * time.Second), Groups: [][]int{{0, 1}, {2, 3}}}}
+	sim, err := NewSimulation(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := sim.Run()
+	if convergence := result.Convergence; convergence.Pass || convergence.Reason == "" || !convergence.UtxoAgree {
+		t.Errorf("partitioned %+v", convergence)
+	}
+
+	chain := sim.Nodes[0].Chain()
+	if prefix := blockchain.CommonPrefix(chain, chain[:3], chain); prefix != 3 {
+		t.Errorf("common prefix %d", prefix)
+	}
+	if prefix := blockchain.CommonPrefix[c.BlockTransactions](); prefix != 0 {
+		t.Errorf("common prefix of no chain %d", prefix)
+	}
+	if prefix := blockchain.CommonPrefix(chain, sim.Nodes[2].Chain()); prefix != result.Convergence.Height+1 {
+		t.Errorf("common prefix %d, height %d", prefix, result.Convergence.Height)
+	}
+
+	// Of the group of node 0, one with a UTXO set a block behind its chain
+	group := sim.Nodes[:2]
+	if convergence := CheckConvergence(group); !convergence.Pass {
+		t.Errorf("group %+v", convergence)
+	}
+	group[1].protected.utxoDb = c.NewUtxoDbFromChain(group[1].Chain()[:len(group[1].Chain())-1])
+	if convergence := CheckConvergence(group); convergence.UtxoAgree || !strings.Contains(convergence.Reason, "node 1") {
+		t.Errorf("stale UTXO set %+v", convergence)
+	}
+
+	// Across the partition, on another tip, one with the UTXO set of the common prefix
+	pair := []*Node{sim.Nodes[0], sim.Nodes[2]}
+	if convergence := CheckConvergence(pair); !convergence.UtxoAgree || convergence.Divergence[1] == 0 {
+		t.Errorf("pair %+v", convergence)
+	}
+	pair[1].protected.utxoDb = c.NewUtxoDbFromChain(pair[1].Chain()[:result.Convergence.Height+1])
+	if convergence := CheckConvergence(pair); convergence.UtxoAgree {
+		t.Errorf("stale UTXO set across tips %+v", convergence)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Nodes = 4
+	scenario.Topology.Kind = TOPOLOGY_RING
+	scenario.Duration = Duration(4 * time.Second)
+	scenario.Link.Loss = 0.1
+	scenario.Strategies = []Strategy{{Node: 0, Kind: STRATEGY_SELFISH, Gamma: 0.5}}
+	sim, err := NewSimulation(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace bytes.Buffer
+	tracer := sim.Record(&trace)
+	sim.Run()
+	if tracer.Err() != nil {
+		t.Fatal(tracer.Err())
+	}
+	records, err := ReadTrace(&trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, original := range sim.Nodes {
+		rejected := 0
+		node, err := Replay(scenario, records, id, func(record TraceRecord, err error) {
+			if record.To != id {
+				t.Errorf("record to %d replayed to %d", record.To, id)
+			}
+			if err != nil {
+				rejected++
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(node.Chain(), original.Chain()) || node.protected.mempool.Len() != original.protected.mempool.Len() {
+			t.Errorf("node %d replayed to another state", id)
+		}
+		if rejected == 0 {
+			t.Errorf("node %d rejected no duplicate", id)
+		}
+	}
+
+	if _, err := Replay(scenario, records, scenario.Nodes, nil); err == nil {
+		t.Error("node out of range replayed")
+	}
+
+	// A coinbase without outputs, mined on the chain node 1 replays to
+	original := sim.Nodes[1]
+	chain := original.Chain()
+	bt := c.NewBlockTransactions(nil, util.Hash{}, uint64(len(chain)), original.sched)
+	bt.CTxn.TxData.TxOuts = nil
+	bt.CTxn.TxId = bt.CTxn.TxData.Hash()
+	b := chain.NextUnmintedBlock(bt, original.sched)
+	b.Mine()
+	data, err := c.EncodeBlock(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spoiled := append(slices.Clone(records), TraceRecord{
+		Time: Duration(original.sched.Elapsed()),
+		Kind: TRACE_BLOCK,
+		To:   1,
+		Data: [][]byte{data}})
+	var last error
+	node, err := Replay(scenario, spoiled, 1, func(record TraceRecord, err error) { last = err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || len(node.Chain()) != len(chain) {
+		t.Error("coinbase without outputs accepted")
+	}
+
+	// Records edited by hand are rejected, not trusted
+	var edited []TraceRecord
+	for _, record := range records {
+		switch {
+		case record.Kind == TRACE_BLOCK && record.To == 1:
+			b, err := c.DecodeBlock(record.Data[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.BlockHeader.Nonce++
+			record.Data[0], err = c.EncodeBlock(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+		case record.Kind == TRACE_TX && record.To == 1:
+			txn, err := c.DecodeRegularTransaction(record.Data[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			txn.TxData.LockTime++
+			record.Data[0], err = c.EncodeRegularTransaction(&txn)
+			if err != nil {
+				t.Fatal(err)
+			}
+		default:
+			continue
+		}
+		edited = append(edited, record)
+	}
+	rejected := 0
+	if _, err := Replay(scenario, edited, 1, func(record TraceRecord, err error) {
+		if err != nil {
+			rejected++
+		}
+	}); err != nil || rejected != len(edited) {
+		t.Errorf("%d of %d edited records rejected, %v", rejected, len(edited), err)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Nodes = 5
+	scenario.Topology.Kind = TOPOLOGY_RING
+	scenario.Duration = Duration(4 * time.Second)
+	sim, err := NewSimulation(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := sim.Run()
+
+	trees := make(map[util.Hash]PropagationTree)
+	for _, tree := range sim.Propagation() {
+		trees[tree.Hash] = tree
+	}
+	for _, b := range sim.mainChain() {
+		tree, ok := trees[b.BlockHash]
+		if !ok || tree.Kind != "block" || tree.Hops[0].Node != tree.Origin || tree.Hops[0].Parent != -1 {
+			t.Fatalf("tree of block %d %+v", b.BlockHeader.Index, tree)
+		}
+		hops := make(map[int]int)
+		for _, hop := range tree.Hops {
+			hops[hop.Node] = hop.Hops
+			if parent, ok := hops[hop.Parent]; hop.Parent != -1 && (!ok || hop.Hops != parent+1 || hop.Delay <= 0) {
+				t.Errorf("hop %+v of block %d", hop, b.BlockHeader.Index)
+			}
+		}
+	}
+
+	redundancy := result.Report.Redundancy
+	if len(redundancy) != 3 || redundancy[0].Kind != "block" || redundancy[0].Duplicates == 0 || redundancy[0].Overhead <= 0 {
+		t.Errorf("redundancy %+v", redundancy)
+	}
+
+	var propagation bytes.Buffer
+	if err := sim.WritePropagation(&propagation); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(propagation.String(), "\n"); lines != len(trees) {
+		t.Errorf("%d lines for %d trees", lines, len(trees))
+	}
+}
@@ -0,0 +1,162 @@
+package sim
+
+import (
+	"fmt"
+	"slices"
+
+	c "gcoin/currency"
+	"gcoin/util"
+)
+
+const (
+	STRATEGY_HONEST       = "honest"       // Mines on the best chain and publishes every block at once
+	STRATEGY_SELFISH      = "selfish"      // Withholds blocks on a private branch, see selfishMiner
+	STRATEGY_DOUBLE_SPEND = "double-spend" // Pays Merchant, then reverses the payment, see doubleSpender
+)
+
+// Strategy replaces the honest behaviour of a node
+type Strategy struct {
+	Node  int
+	Kind  string
+	Gamma float64 // Of STRATEGY_SELFISH, probability that an honest node in a tie switches to its block
+
+	// Of STRATEGY_DOUBLE_SPEND
+	Merchant      int    // Node paid
+	Amount        uint64 // Of every payment
+	Confirmations int    // Of the payment before the private branch is published
+	GiveUp        int    // Blocks of work behind the public chain to abandon an attack at, 0 to never
+}
+
+func (strategy *Strategy) Validate(n int) error {
+	if strategy.Node < 0 || strategy.Node >= n {
+		return fmt.Errorf("node %d out of range", strategy.Node)
+	}
+	switch strategy.Kind {
+	case STRATEGY_HONEST, STRATEGY_SELFISH, STRATEGY_DOUBLE_SPEND:
+	default:
+		return fmt.Errorf("unknown strategy %q", strategy.Kind)
+	}
+	if strategy.Gamma < 0 || strategy.Gamma > 1 {
+		return fmt.Errorf("gamma %v not a probability", strategy.Gamma)
+	}
+	if strategy.Kind == STRATEGY_DOUBLE_SPEND {
+		if strategy.Merchant < 0 || strategy.Merchant >= n || strategy.Merchant == strategy.Node {
+			return fmt.Errorf("merchant %d invalid", strategy.Merchant)
+		}
+		if strategy.Amount == 0 {
+			return fmt.Errorf("amount is 0")
+		}
+		if strategy.Confirmations < 0 || strategy.GiveUp < 0 {
+			return fmt.Errorf("negative confirmations or give up")
+		}
+	}
+	return nil
+}
+
+// newAgent is the agent of strategy, nil for an honest node
+func newAgent(strategy Strategy, nodes []*Node) agent {
+	switch strategy.Kind {
+	case STRATEGY_SELFISH:
+		return &selfishMiner{gamma: strategy.Gamma}
+	case STRATEGY_DOUBLE_SPEND:
+		return &doubleSpender{strategy: strategy, merchant: nodes[strategy.Merchant]}
+	default:
+		return nil
+	}
+}
+
+// agent decides what a dishonest node mines and when it publishes
+type agent interface {
+	nextBlock(node *Node) c.Block     // To be mined
+	blockMined(node *Node, b c.Block) // Instead of connecting and relaying b
+	tipChanged(node *Node)            // After handling blocks from peers
+}
+
+/*
+ * selfishMiner mines on a private branch and publishes its blocks by
+ * the state machine of Eyal and Sirer, where the lead of the private branch
+ * over the public chain is in cumulative Diff, as handleBlock chooses forks:
+ *
+ * 1. Finding a block while tied with the public chain publishes it to win the race
+ * 2. Finding a block otherwise keeps it private
+ * 3. When the public chain catches up:
+ *    - ahead of the private branch, the branch is abandoned for it
+ *    - tied, the branch is published for a race honest nodes join with gamma
+ *    - a block of work behind, the branch is published to override it
+ *    - further behind, the blocks up to its work are published
+ *
+ * Private blocks only hold a coinbase, so the private branch needs no UTXO set.
+ */
+type selfishMiner struct {
+	gamma     float64
+	private   c.Chain
+	published int // Private blocks published so far
+}
+
+// adopt abandons the private branch for the public chain.
+// Assume node.mu is held
+func (sm *selfishMiner) adopt(node *Node) {
+	sm.private = slices.Clone(node.protected.chain)
+}
+
+func (sm *selfishMiner) nextBlock(node *Node) c.Block {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if sm.private.Difficulty() < node.protected.chain.Difficulty() {
+		sm.adopt(node)
+	}
+	return privateBlock(node, sm.private, nil)
+}
+
+// publish connects and relays the private blocks below height not published yet
+func (sm *selfishMiner) publish(node *Node, height int) {
+	for _, b := range sm.private[:height] {
+		if _, ok := node.blocks[b.BlockHash]; ok {
+			continue
+		}
+		node.publishWithheld(b, sm.gamma)
+		sm.published++
+	}
+}
+
+// privateBlock is the next block of a private branch, holding txns
+// and a coinbase to node. Assume node.mu is held
+func privateBlock(node *Node, private c.Chain, txns []c.RegularTransaction) c.Block {
+	height := uint64(len(private))
+	bt := c.NewBlockTransactions(txns, node.wallet.GetAddress(), height, node.sched)
+	return private.NextUnmintedBlock(bt, node.sched)
+}
+
+func (sm *selfishMiner) blockMined(node *Node, b c.Block) {
+	public := node.Chain()
+	racing := sm.private.Difficulty() == public.Difficulty() && sm.private.ForkIndex(public) < len(public)
+	sm.private = append(sm.private, b)
+	node.metrics.minedBlocks.Inc()
+	if racing {
+		sm.publish(node, len(sm.private))
+	}
+	node.restartMining()
+}
+
+func (sm *selfishMiner) tipChanged(node *Node) {
+	public := node.Chain()
+	if sm.private.ForkIndex(public) == len(public) {
+		return // The public chain holds no block but ours
+	}
+	// A block of work at the target of the public tip
+	work := uint64(1) << util.Last(public).BlockHeader.Target
+	switch private, diff := sm.private.Difficulty(), public.Difficulty(); {
+	case private < diff:
+		node.mu.Lock()
+		sm.adopt(node)
+		node.mu.Unlock()
+		node.restartMining()
+	case private <= diff+work:
+		sm.publish(node, len(sm.private))
+	default:
+		// Up to the first private block with as much work as the public chain
+		height := 1 + slices.IndexFunc(sm.private, func(b c.Block) bool { return b.BlockHeader.Diff >= diff })
+		sm.publish(node, height)
+	}
+}
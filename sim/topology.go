@@ -0,0 +1,52 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"gcoin/topology"
+)
+
+const (
+	TOPOLOGY_BIPARTITE       = "bipartite"       // Two groups, each node connected to every node of the other group
+	TOPOLOGY_CLIQUE          = "clique"          // Every node connected to every other
+	TOPOLOGY_RING            = "ring"            // Node i connected to i-1 and i+1
+	TOPOLOGY_REGULAR         = "regular"         // Every node connected to Degree random others
+	TOPOLOGY_ERDOS_RENYI     = "erdos-renyi"     // Every two nodes connected with probability P
+	TOPOLOGY_WATTS_STROGATZ  = "watts-strogatz"  // Ring of Degree nearest neighbours, each link rewired with probability P
+	TOPOLOGY_BARABASI_ALBERT = "barabasi-albert" // Every new node connected to Degree others by preferential attachment
+	TOPOLOGY_FILE            = "file"            // Edge list at Path
+)
+
+type Topology struct {
+	Kind   string
+	Degree int     // Parameter of TOPOLOGY_REGULAR, TOPOLOGY_WATTS_STROGATZ and TOPOLOGY_BARABASI_ALBERT
+	P      float64 // Parameter of TOPOLOGY_ERDOS_RENYI and TOPOLOGY_WATTS_STROGATZ
+	Path   string  // Of TOPOLOGY_FILE, relative to the scenario
+}
+
+// Graph generates the peers of each of n nodes, random graphs are drawn from seed
+func (t *Topology) Graph(n int, seed uint64) (topology.Graph, error) {
+	rd := rand.New(rand.NewPCG(seed, math.MaxUint64)) // Apart from the streams of the nodes
+	switch t.Kind {
+	case TOPOLOGY_BIPARTITE:
+		return topology.Bipartite(n), nil
+	case TOPOLOGY_CLIQUE:
+		return topology.Clique(n), nil
+	case TOPOLOGY_RING:
+		return topology.Ring(n), nil
+	case TOPOLOGY_REGULAR:
+		return topology.RandomRegular(n, t.Degree, rd)
+	case TOPOLOGY_ERDOS_RENYI:
+		return topology.ErdosRenyi(n, t.P, rd)
+	case TOPOLOGY_WATTS_STROGATZ:
+		return topology.WattsStrogatz(n, t.Degree, t.P, rd)
+	case TOPOLOGY_BARABASI_ALBERT:
+		return topology.BarabasiAlbert(n, t.Degree, rd)
+	case TOPOLOGY_FILE:
+		return topology.LoadEdgeList(t.Path, n)
+	default:
+		return nil, fmt.Errorf("unknown topology %q", t.Kind)
+	}
+}
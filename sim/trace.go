@@ -0,0 +1,172 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	c "gcoin/currency"
+)
+
+const (
+	TRACE_BLOCK   = "block"   // Relayed by a peer, to handleBlock with Gamma
+	TRACE_BLOCKS  = "blocks"  // Sent by a peer in reply to getblocks, each to handleBlock
+	TRACE_TX      = "tx"      // Relayed by a peer, or made by the node itself, to handleTransaction
+	TRACE_MINED   = "mined"   // Found by the node, to handleMinedBlock
+	TRACE_PUBLISH = "publish" // Withheld by the agent of the node until now, to handleBlock
+)
+
+// TraceRecord is a message delivered to node To, in the order of delivery
+type TraceRecord struct {
+	Time  Duration
+	Kind  string
+	From  int // The node itself for TRACE_TX it made, TRACE_MINED and TRACE_PUBLISH
+	To    int
+	Gamma float64  // Of TRACE_BLOCK
+	Data  [][]byte // Blocks encoded by currency.EncodeBlock, or a transaction by currency.EncodeRegularTransaction
+}
+
+// Tracer writes TraceRecords as lines of JSON
+type Tracer struct {
+	enc *json.Encoder
+	err error // First error, after which nothing is written
+}
+
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{enc: json.NewEncoder(w)}
+}
+
+// Err is the first error encoding or writing a record
+func (tracer *Tracer) Err() error {
+	return tracer.err
+}
+
+func (tracer *Tracer) write(record TraceRecord) {
+	if tracer.err == nil {
+		tracer.err = tracer.enc.Encode(record)
+	}
+}
+
+// Record traces the messages delivered to the nodes of sim to w
+func (sim *Simulation) Record(w io.Writer) *Tracer {
+	tracer := NewTracer(w)
+	for _, node := range sim.Nodes {
+		node.tracer = tracer
+	}
+	return tracer
+}
+
+// record traces blocks or txn delivered to node from, unless node is not traced
+func (node *Node) record(kind string, from *Node, gamma float64, blocks []c.Block, txn *c.RegularTransaction) {
+	if node.tracer == nil {
+		return
+	}
+	record := TraceRecord{Time: Duration(node.sched.Elapsed()), Kind: kind, From: from.id, To: node.id, Gamma: gamma}
+	for i := range blocks {
+		data, err := c.EncodeBlock(&blocks[i])
+		if err != nil {
+			node.tracer.err = errors.Join(node.tracer.err, err)
+			return
+		}
+		record.Data = append(record.Data, data)
+	}
+	if txn != nil {
+		data, err := c.EncodeRegularTransaction(txn)
+		if err != nil {
+			node.tracer.err = errors.Join(node.tracer.err, err)
+			return
+		}
+		record.Data = append(record.Data, data)
+	}
+	node.tracer.write(record)
+}
+
+// ReadTrace reads the records written by a Tracer
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+	dec := json.NewDecoder(r)
+	var records []TraceRecord
+	for {
+		var record TraceRecord
+		if err := dec.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(records), err)
+		}
+		records = append(records, record)
+	}
+}
+
+// Replay feeds the records delivered to node id into a fresh node of scenario,
+// in order and at their time, and calls observe with each record and the error
+// of its handler. Given the trace of a run of scenario, the node takes the
+// same decisions as in the run, but neither mines nor relays.
+func Replay(scenario Scenario, records []TraceRecord, id int, observe func(record TraceRecord, err error)) (*Node, error) {
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+	if id < 0 || id >= scenario.Nodes {
+		return nil, fmt.Errorf("node %d out of range", id)
+	}
+	sched := NewScheduler()
+	node := NewNode(id, &scenario, sched)
+	for i, record := range records {
+		if record.To != id {
+			continue
+		}
+		// Without running the mining the handlers schedule
+		sched.now = time.Duration(record.Time)
+		err := node.replay(record)
+		if errors.Is(err, errUndecodable) {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		if observe != nil {
+			observe(record, err)
+		}
+	}
+	return node, nil
+}
+
+var errUndecodable = errors.New("undecodable record")
+
+// replay hands record to the handler that took its message
+func (node *Node) replay(record TraceRecord) error {
+	var blocks []c.Block
+	var txn c.RegularTransaction
+	for _, data := range record.Data {
+		var err error
+		if record.Kind == TRACE_TX {
+			txn, err = c.DecodeRegularTransaction(data)
+		} else {
+			var b c.Block
+			b, err = c.DecodeBlock(data)
+			blocks = append(blocks, b)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errUndecodable, err)
+		}
+	}
+	if len(record.Data) == 0 || (record.Kind != TRACE_BLOCKS && len(record.Data) != 1) {
+		return fmt.Errorf("%w: %d items in %s", errUndecodable, len(record.Data), record.Kind)
+	}
+
+	switch record.Kind {
+	case TRACE_BLOCK:
+		return node.handleBlock(blocks[0], record.Gamma)
+	case TRACE_BLOCKS:
+		var errs []error
+		for _, b := range blocks {
+			errs = append(errs, node.handleBlock(b, 0))
+		}
+		return errors.Join(errs...)
+	case TRACE_TX:
+		return node.handleTransaction(txn)
+	case TRACE_MINED:
+		return node.handleMinedBlock(blocks[0])
+	case TRACE_PUBLISH:
+		return node.handleBlock(blocks[0], 0)
+	default:
+		return fmt.Errorf("%w: kind %q", errUndecodable, record.Kind)
+	}
+}
@@ -0,0 +1,60 @@
+package topology
+
+type Stats struct {
+	Nodes      int
+	Edges      int
+	MinDegree  int
+	MaxDegree  int
+	MeanDegree float64
+	Degrees    []int // Degrees[d] nodes have degree d
+	Diameter   int   // Hops of the longest shortest path between two connected nodes
+	Connected  bool
+}
+
+// distances are the hops from node i to every node, -1 if unreachable
+func (g Graph) distances(i int) []int {
+	dist := make([]int, len(g))
+	for j := range dist {
+		dist[j] = -1
+	}
+	dist[i] = 0
+	queue := []int{i}
+	for len(queue) != 0 {
+		j := queue[0]
+		queue = queue[1:]
+		for _, l := range g[j] {
+			if dist[l] == -1 {
+				dist[l] = dist[j] + 1
+				queue = append(queue, l)
+			}
+		}
+	}
+	return dist
+}
+
+// Stats measures g with a breadth-first search from every node
+func (g Graph) Stats() Stats {
+	stats := Stats{Nodes: len(g), Edges: g.Edges(), Connected: true}
+	if len(g) == 0 {
+		return stats
+	}
+	stats.MinDegree = len(g[0])
+	for i, neighbours := range g {
+		degree := len(neighbours)
+		stats.MinDegree = min(stats.MinDegree, degree)
+		stats.MaxDegree = max(stats.MaxDegree, degree)
+		for len(stats.Degrees) <= degree {
+			stats.Degrees = append(stats.Degrees, 0)
+		}
+		stats.Degrees[degree]++
+
+		for _, d := range g.distances(i) {
+			if d == -1 {
+				stats.Connected = false
+			}
+			stats.Diameter = max(stats.Diameter, d)
+		}
+	}
+	stats.MeanDegree = float64(2*stats.Edges) / float64(len(g))
+	return stats
+}
@@ -0,0 +1,224 @@
+// Package topology generates the undirected graphs that simulated nodes
+// are wired by, and measures their degrees and diameter.
+package topology
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const MAX_ATTEMPTS = 100 // Of a random generator before giving up
+
+// Graph lists the neighbours of each node, every edge goes both ways
+type Graph [][]int
+
+func newGraph(n int) Graph {
+	return make(Graph, n)
+}
+
+// link adds the edge between i and j unless it is a loop or exists already
+func (g Graph) link(i int, j int) bool {
+	if i == j || g.Has(i, j) {
+		return false
+	}
+	g[i] = append(g[i], j)
+	g[j] = append(g[j], i)
+	return true
+}
+
+func (g Graph) Has(i int, j int) bool {
+	return slices.Contains(g[i], j)
+}
+
+// Edges is the number of edges of g
+func (g Graph) Edges() int {
+	edges := 0
+	for _, neighbours := range g {
+		edges += len(neighbours)
+	}
+	return edges / 2
+}
+
+// Bipartite splits n nodes in two groups, each node linked to every node of the other
+func Bipartite(n int) Graph {
+	g := newGraph(n)
+	for i := range n / 2 {
+		for j := n / 2; j < n; j++ {
+			g.link(i, j)
+		}
+	}
+	return g
+}
+
+// Clique links every node to every other
+func Clique(n int) Graph {
+	g := newGraph(n)
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			g.link(i, j)
+		}
+	}
+	return g
+}
+
+// Ring links node i to i-1 and i+1
+func Ring(n int) Graph {
+	g := newGraph(n)
+	for i := range n {
+		g.link(i, (i+1)%n)
+	}
+	return g
+}
+
+// RandomRegular links every node to k others, drawn uniformly by pairing
+// the k stubs of each node at random and starting over on a dead end
+func RandomRegular(n int, k int, rd *rand.Rand) (Graph, error) {
+	if k < 0 || k >= n || n*k%2 != 0 {
+		return nil, fmt.Errorf("no %d-regular graph of %d nodes", k, n)
+	}
+	for range MAX_ATTEMPTS {
+		g := newGraph(n)
+		var stubs []int
+		for i := range n {
+			for range k {
+				stubs = append(stubs, i)
+			}
+		}
+		for len(stubs) != 0 {
+			paired := false
+			for range MAX_ATTEMPTS {
+				a, b := rd.IntN(len(stubs)), rd.IntN(len(stubs))
+				if a != b && g.link(stubs[a], stubs[b]) {
+					stubs = slices.Delete(stubs, max(a, b), max(a, b)+1)
+					stubs = slices.Delete(stubs, min(a, b), min(a, b)+1)
+					paired = true
+					break
+				}
+			}
+			if !paired {
+				break
+			}
+		}
+		if len(stubs) == 0 {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("no %d-regular graph of %d nodes found", k, n)
+}
+
+// ErdosRenyi links every two nodes with probability p
+func ErdosRenyi(n int, p float64, rd *rand.Rand) (Graph, error) {
+	if p < 0 || p > 1 {
+		return nil, fmt.Errorf("p %v not a probability", p)
+	}
+	g := newGraph(n)
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			if rd.Float64() < p {
+				g.link(i, j)
+			}
+		}
+	}
+	return g, nil
+}
+
+// WattsStrogatz links every node to its k nearest on a ring, then rewires
+// each of these edges to a random node with probability beta
+func WattsStrogatz(n int, k int, beta float64, rd *rand.Rand) (Graph, error) {
+	if k < 2 || k%2 != 0 || k >= n {
+		return nil, fmt.Errorf("k %d not even and in [2, %d)", k, n)
+	}
+	if beta < 0 || beta > 1 {
+		return nil, fmt.Errorf("beta %v not a probability", beta)
+	}
+	g := newGraph(n)
+	for i := range n {
+		for d := 1; d <= k/2; d++ {
+			g.link(i, (i+d)%n)
+		}
+	}
+	for d := 1; d <= k/2; d++ {
+		for i := range n {
+			j := (i + d) % n
+			// The edge stays if every other node is a neighbour of i already
+			if rd.Float64() >= beta || !g.Has(i, j) || len(g[i]) == n-1 {
+				continue
+			}
+			for range MAX_ATTEMPTS {
+				if l := rd.IntN(n); g.link(i, l) {
+					g.unlink(i, j)
+					break
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+func (g Graph) unlink(i int, j int) {
+	g[i] = slices.DeleteFunc(g[i], func(l int) bool { return l == j })
+	g[j] = slices.DeleteFunc(g[j], func(l int) bool { return l == i })
+}
+
+// BarabasiAlbert starts from a clique of m+1 nodes, then links each new
+// node to m distinct nodes drawn with probability proportional to their degree
+func BarabasiAlbert(n int, m int, rd *rand.Rand) (Graph, error) {
+	if m < 1 || m >= n {
+		return nil, fmt.Errorf("m %d not in [1, %d)", m, n)
+	}
+	g := newGraph(n)
+	var ends []int // Every node once per edge it has
+	for i := range m + 1 {
+		for j := i + 1; j < m+1; j++ {
+			g.link(i, j)
+			ends = append(ends, i, j)
+		}
+	}
+	for i := m + 1; i < n; i++ {
+		for len(g[i]) < m {
+			if j := ends[rd.IntN(len(ends))]; g.link(i, j) {
+				ends = append(ends, j)
+			}
+		}
+		for range m {
+			ends = append(ends, i)
+		}
+	}
+	return g, nil
+}
+
+// LoadEdgeList reads a graph of n nodes from lines of two node indexes.
+// Blank lines and those starting with # are skipped.
+func LoadEdgeList(path string, n int) (Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g := newGraph(n)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: not an edge", path, line)
+		}
+		var ends [2]int
+		for k, field := range fields {
+			if ends[k], err = strconv.Atoi(field); err != nil || ends[k] < 0 || ends[k] >= n {
+				return nil, fmt.Errorf("%s:%d: node %q not in [0, %d)", path, line, field, n)
+			}
+		}
+		g.link(ends[0], ends[1])
+	}
+	return g, scanner.Err()
+}
@@ -0,0 +1,99 @@
+package topology
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func checkSymmetric(t *testing.T, g Graph) {
+	for i, neighbours := range g {
+		for _, j := range neighbours {
+			if i == j || !g.Has(j, i) {
+				t.Fatalf("edge %d-%d invalid", i, j)
+			}
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	rd := rand.New(rand.NewPCG(1, 2))
+	regular, err := RandomRegular(20, 3, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSymmetric(t, regular)
+	if stats := regular.Stats(); stats.MinDegree != 3 || stats.MaxDegree != 3 {
+		t.Errorf("regular %+v", stats)
+	}
+	if _, err := RandomRegular(5, 3, rd); err == nil {
+		t.Error("odd number of stubs accepted")
+	}
+
+	smallWorld, err := WattsStrogatz(30, 4, 0.2, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSymmetric(t, smallWorld)
+	if edges := smallWorld.Edges(); edges != 60 {
+		t.Errorf("small world has %d edges", edges)
+	}
+
+	scaleFree, err := BarabasiAlbert(50, 2, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSymmetric(t, scaleFree)
+	if stats := scaleFree.Stats(); stats.MinDegree < 2 || stats.Edges != 3+2*47 || !stats.Connected {
+		t.Errorf("scale free %+v", stats)
+	}
+
+	empty, err := ErdosRenyi(10, 0, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := ErdosRenyi(10, 1, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Edges() != 0 || full.Edges() != 45 {
+		t.Errorf("edges %d and %d", empty.Edges(), full.Edges())
+	}
+}
+
+func TestStats(t *testing.T) {
+	stats := Ring(7).Stats()
+	if stats.Edges != 7 || stats.Diameter != 3 || stats.MeanDegree != 2 || !stats.Connected {
+		t.Errorf("ring %+v", stats)
+	}
+	if stats := Clique(5).Stats(); stats.Diameter != 1 || stats.Degrees[4] != 5 {
+		t.Errorf("clique %+v", stats)
+	}
+	if stats := Bipartite(4).Stats(); stats.Diameter != 2 || stats.Edges != 4 {
+		t.Errorf("bipartite %+v", stats)
+	}
+	g := newGraph(4)
+	g.link(0, 1)
+	g.link(2, 3)
+	if stats := g.Stats(); stats.Connected || stats.Diameter != 1 {
+		t.Errorf("disconnected %+v", stats)
+	}
+}
+
+func TestLoadEdgeList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edges.txt")
+	if err := os.WriteFile(path, []byte("# star\n0 1\n0 2\n\n0 3\n1 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := LoadEdgeList(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := g.Stats(); stats.Edges != 3 || stats.MaxDegree != 3 || stats.Diameter != 2 {
+		t.Errorf("star %+v", stats)
+	}
+	if _, err := LoadEdgeList(path, 3); err == nil {
+		t.Error("node out of range accepted")
+	}
+}
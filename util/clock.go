@@ -0,0 +1,15 @@
+package util
+
+import "time"
+
+// Clock tells the time in milliseconds since the Unix epoch
+type Clock interface {
+	Now() int64
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() int64 {
+	return time.Now().UnixMilli()
+}
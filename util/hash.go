@@ -3,8 +3,10 @@ package util
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
+	"fmt"
 	"math/bits"
 )
 
@@ -18,6 +20,14 @@ func (hash Hash) MarshalText() ([]byte, error) {
 	return []byte(hash.String()), nil
 }
 
+func (hash *Hash) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(hash) {
+		return fmt.Errorf("hash of %d hex digits", len(text))
+	}
+	_, err := hex.Decode(hash[:], text)
+	return err
+}
+
 func (hash Hash) LeadingZeros() int {
 	cnt := 0
 	for _, x := range hash {
@@ -38,6 +48,19 @@ func NewHash[T any](data T) Hash {
 	return sha256.Sum256(buf.Bytes())
 }
 
+// NewBinaryHash is over the big-endian encoding of each of data in order,
+// which must be fixed-size. Unlike a gob encoding, whose type ids depend on
+// what the process encoded before, it is the same in every process.
+func NewBinaryHash(data ...any) Hash {
+	var buf bytes.Buffer
+	for _, d := range data {
+		if err := binary.Write(&buf, binary.BigEndian, d); err != nil {
+			panic(err)
+		}
+	}
+	return sha256.Sum256(buf.Bytes())
+}
+
 type Hashable interface {
 	Hash() Hash
 }
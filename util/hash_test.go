@@ -1,6 +1,9 @@
 package util
 
-import "testing"
+import (
+	"crypto/sha256"
+	"testing"
+)
 
 func TestNewHash(t *testing.T) {
 	h1 := NewHash(1)
@@ -11,3 +14,30 @@ func TestNewHash(t *testing.T) {
 		t.Errorf("same hash")
 	}
 }
+
+func TestHashText(t *testing.T) {
+	h1 := NewHash(1)
+	text, err := h1.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h2 Hash
+	if err := h2.UnmarshalText(text); err != nil || h1 != h2 {
+		t.Errorf("%s != %s", h1, h2)
+	}
+	if err := h2.UnmarshalText(text[1:]); err == nil {
+		t.Errorf("short hash accepted")
+	}
+}
+
+func TestNewBinaryHash(t *testing.T) {
+	if h := NewBinaryHash(uint64(1), []uint8{2, 3}); h != sha256.Sum256([]byte{0, 0, 0, 0, 0, 0, 0, 1, 2, 3}) {
+		t.Errorf("hash %s", h)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("hashed a string")
+		}
+	}()
+	NewBinaryHash("not fixed-size")
+}